@@ -21,27 +21,84 @@ import (
 	"strings"
 	"time"
 	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/outbox"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // addCmd represents the add command
 var addCmd = &cobra.Command{
 	Use:   "add",
 	Short: "Adds a new task",
+	Long: `Adds a new task and creates a Jira issue for it unless --offline is given.
+
+Tags and priority can be given inline. Words starting with + or @ become tags
+and a word starting with ! sets the priority:
+
+  todo add fix login +backend @office !high
+
+Due and start dates accept e.g. "tomorrow", "fri 17:00", "next monday",
+"+3d" or "2018-05-01". A task is hidden from 'todo list' until its start date.
+
+With --every the task recurs, completing it adds the next occurrence:
+
+  todo add weekly report --every fri
+
+Rules are weekdays like "fri" or "mon,wed", "weekdays", "daily", "weekly",
+intervals like "2w", days of the month like "1st" or "last", or an RRULE like
+"FREQ=MONTHLY;BYMONTHDAY=1". Every occurrence of a linked task gets a new Jira
+issue, with --reopen the issue is re-opened instead`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		offline, err := cmd.Flags().GetBool("offline")
 		if err != nil {
 			return fmt.Errorf("Invalid value for offline")
 		}
-		return t.Add(strings.Join(args, " "), offline)
+		task, err := parseInline(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		if err = setFields(cmd, task); err != nil {
+			return err
+		}
+		return t.AddTask(task, offline)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(addCmd)
 	addCmd.Flags().BoolP("offline", "o", false, "Offline mode (Don't create JIRA task)")
+	addCmd.Flags().String("due", "", "Due date")
+	addCmd.Flags().String("start", "", "Start date, the task is hidden until then")
+	addCmd.Flags().StringP("priority", "p", "", "Priority [Highest, High, Medium, Low, Lowest or A-E]")
+	addCmd.Flags().StringSliceP("tag", "t", nil, "Tag the task, can be repeated")
+	addCmd.Flags().String("every", "", "Repeat the task, e.g. \"fri\", \"2w\", \"15th\" or an RRULE")
+	addCmd.Flags().Bool("reopen", false, "Re-open the Jira issue for the next occurrence instead of creating a new one")
+}
+
+// parseInline returns a task for text with +tags, @contexts and a !priority
+// moved from the text to their own fields
+func parseInline(text string) (*config.Task, error) {
+	task := &config.Task{}
+	var words []string
+	for _, word := range strings.Fields(text) {
+		switch {
+		case len(word) > 1 && word[0] == '+':
+			task.Tags = addTags(task.Tags, word[1:])
+		case len(word) > 1 && word[0] == '@':
+			task.Tags = addTags(task.Tags, word)
+		case len(word) > 1 && word[0] == '!':
+			p, err := config.ParsePriority(word)
+			if err != nil {
+				return nil, err
+			}
+			task.Priority = p
+		default:
+			words = append(words, word)
+		}
+	}
+	task.Text = strings.Join(words, " ")
+	return task, nil
 }
 
 type jiraReply struct {
@@ -52,45 +109,102 @@ type jiraReply struct {
 
 // Add a new task
 func (t *Todo) Add(text string, offline bool) error {
-	if text == "" {
+	return t.AddTask(&config.Task{Text: text}, offline)
+}
+
+// AddTask adds a new task with the fields already set on task
+func (t *Todo) AddTask(task *config.Task, offline bool) error {
+	if task.Text == "" {
 		return fmt.Errorf("Your todo can't be empty")
 	}
-	if t.JC.BaseURL == "" {
+	if t.JC == nil || t.JC.BaseURL == "" {
 		return fmt.Errorf("Could not read configuration. Run 'todo init'")
 	}
-	task := &config.Task{
-		Text:    text,
-		Done:    false,
-		Created: time.Now(),
+	task.Done = false
+	task.Created = time.Now()
+	if err := scheduleRecurrence(task, task.Created); err != nil {
+		return err
+	}
+	c := change{
+		task:  task,
+		local: func() error { return t.Store.Add(task) },
+		entry: &journal.Entry{Op: "add"},
 	}
 	if !offline {
-		issue := &jira.Issue{
-			Fields: jira.Fields{
-				Summary: fmt.Sprintf("TODO: %s", task.Text),
-				Project: jira.IssueProject{
-					ID: t.Config.Jira.Project.ID,
-				},
-				IssueType: jira.IssueType{
-					ID: t.Config.Jira.Project.IssueType,
-				},
+		t.useProfile(task)
+		c.remote = func() error { return t.createJira(task) }
+		c.rollback = func() error { return t.deleteIssue(task) }
+		c.queue = func() []*outbox.Op { return createOps(task) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was created", task.JiraKey) }
+		c.repair = "Delete the Jira issue and add the task again."
+	}
+	if err := t.apply(c); err != nil {
+		return err
+	}
+	t.status("Task added: '%s'", task.Text)
+	return nil
+}
+
+// newIssue returns the Jira issue representing task in project
+func newIssue(task *config.Task, project *config.Project) *jira.Issue {
+	issue := &jira.Issue{
+		Fields: jira.Fields{
+			Summary: summary(task),
+			Project: jira.IssueProject{
+				ID: project.ID,
 			},
-		}
-		err := t.createJira(issue, task)
-		if err != nil {
-			return fmt.Errorf("Unable to create Jira issue: %v", err)
-		}
+			IssueType: jira.IssueType{
+				ID: project.IssueType,
+			},
+			DueDate: jiraDate(task.Due),
+			Labels:  task.Tags,
+		},
+	}
+	if task.Priority != "" {
+		issue.Fields.Priority = &jira.Priority{Name: task.Priority}
 	}
+	return issue
+}
 
-	t.Config.Tasks = append(t.Config.Tasks, task)
-	config.Write(viper.ConfigFileUsed(), &t.Config)
-	fmt.Println(fmt.Sprintf("Task added: '%s'", task.Text))
-	return nil
+// issueFields returns the Jira fields of an existing issue that mirror
+// fields of task. Priority is left out when the task has none, since most
+// Jira projects don't allow clearing it
+func issueFields(task *config.Task) map[string]interface{} {
+	fields := map[string]interface{}{
+		"summary": summary(task),
+		"duedate": nil,
+		"labels":  append([]string{}, task.Tags...),
+	}
+	if d := jiraDate(task.Due); d != "" {
+		fields["duedate"] = d
+	}
+	if task.Priority != "" {
+		fields["priority"] = map[string]string{"name": task.Priority}
+	}
+	return fields
 }
 
-func (t *Todo) createJira(issue *jira.Issue, task *config.Task) error {
-	b, err := t.JC.CreateIssue(issue)
+// summary returns the Jira issue summary of task
+func summary(task *config.Task) string {
+	return fmt.Sprintf("TODO: %s", task.Text)
+}
+
+func jiraDate(d time.Time) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(jira.DateFormat)
+}
+
+// createJira creates the issue of task in the project of its profile
+func (t *Todo) createJira(task *config.Task) error {
+	jc, j, err := t.jiraFor(task)
+	if err != nil {
+		return err
+	}
+	b, err := jc.CreateIssueContext(t.ctx(), newIssue(task, &j.Project))
 	if err != nil {
-		return fmt.Errorf("Unable to create Jira issue; %v", err)
+		return fmt.Errorf("Unable to create Jira issue; %w", err)
 	}
 	jr := &jiraReply{}
 	err = json.Unmarshal(b, jr)
@@ -99,5 +213,6 @@ func (t *Todo) createJira(issue *jira.Issue, task *config.Task) error {
 	}
 	task.JiraID = jr.ID
 	task.JiraKey = jr.Key
+	task.Project = j.Project.Key
 	return nil
 }
@@ -0,0 +1,258 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"jira"
+	"os"
+	"strings"
+	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/outbox"
+)
+
+// OutOfSyncError is returned when a command changed Jira but could not save
+// the task locally, and the Jira change could not be reverted either
+type OutOfSyncError struct {
+	Task *config.Task
+	// Remote describes what was changed in Jira
+	Remote string
+	// Err is why the task could not be saved
+	Err error
+	// Rollback is why the Jira change could not be reverted. It is nil if
+	// the change can't be reverted at all
+	Rollback error
+	// Retry saves the task again
+	Retry func() error
+	// Repair describes how to get Jira and the todo list back in sync by hand
+	Repair string
+}
+
+func (e *OutOfSyncError) Error() string {
+	msg := fmt.Sprintf("%s, but task %d could not be saved: %v", e.Remote, e.Task.ID, e.Err)
+	if e.Rollback != nil {
+		msg = fmt.Sprintf("%s\nReverting the Jira change failed as well: %v", msg, e.Rollback)
+	}
+	return msg
+}
+
+// change is the Jira side and the local side of a command
+type change struct {
+	task *config.Task
+	// remote performs the Jira side. It is optional
+	remote func() error
+	// local saves the task
+	local func() error
+	// rollback reverts remote if local fails. It is optional
+	rollback func() error
+	// done describes what remote changed in Jira
+	done   func() string
+	repair string
+	// entry is recorded in the journal once the task is saved. Its After
+	// is filled in by apply unless deleted is set
+	entry   *journal.Entry
+	deleted bool
+	// queue returns remote as outbox operations. It is called once the task
+	// is saved if Jira can't be reached. Without it remote must succeed
+	queue func() []*outbox.Op
+}
+
+// apply runs the Jira side of c before the local side. If the local side
+// fails the Jira side is rolled back, and if that fails too the caller
+// gets an *OutOfSyncError telling exactly what is out of sync. The saved
+// task is printed in the format chosen with --output
+//
+// If Jira can't be reached, or earlier changes are still queued, the Jira
+// side is queued in the outbox instead and the task is saved right away
+func (t *Todo) apply(c change) error {
+	queued := false
+	if c.remote != nil {
+		canQueue := c.queue != nil && t.Outbox != nil
+		if canQueue && len(t.Outbox.Pending()) > 0 {
+			queued = true
+		} else if err := c.remote(); err != nil {
+			if !canQueue || !jira.IsNetworkError(err) {
+				return explain(c.task, err)
+			}
+			queued = true
+		}
+	}
+	local := func() error {
+		if err := c.local(); err != nil {
+			return err
+		}
+		t.record(c)
+		if !queued {
+			t.markSynced(c)
+		}
+		if c.deleted && t.Outbox != nil {
+			if err := t.Outbox.Forget(c.task.ID); err != nil {
+				t.status("Unable to drop the queued Jira changes of task %d: %v", c.task.ID, err)
+			}
+		}
+		return nil
+	}
+	err := local()
+	if err == nil && queued {
+		if err = t.Outbox.Add(c.queue()...); err != nil {
+			return fmt.Errorf("Task saved, but the Jira change could not be queued: %v", err)
+		}
+		t.status("Jira can't be reached, the change is queued. Run 'todo flush' to send it")
+	}
+	if err == nil {
+		return t.printTask(c.task)
+	}
+	if c.remote == nil || queued {
+		return fmt.Errorf("Unable to save task: %v", err)
+	}
+	e := &OutOfSyncError{
+		Task:   c.task,
+		Remote: c.done(),
+		Err:    err,
+		Retry:  local,
+		Repair: c.repair,
+	}
+	if c.rollback != nil {
+		// The Jira change is reverted even if the command was interrupted
+		ctx := t.Context
+		t.Context = context.WithoutCancel(t.ctx())
+		e.Rollback = c.rollback()
+		t.Context = ctx
+		if e.Rollback == nil {
+			return fmt.Errorf("Unable to save task, the Jira change was reverted: %v", err)
+		}
+	}
+	return e
+}
+
+// explain adds what to do about it to an error Jira answered a change to
+// task with
+func explain(task *config.Task, err error) error {
+	var apiErr *jira.APIError
+	if task == nil || !errors.As(err, &apiErr) {
+		return err
+	}
+	switch {
+	case jira.IsNotFound(err) && task.JiraKey != "":
+		return fmt.Errorf(
+			"Jira issue %s no longer exists. Run 'todo sync' to decide what to do with task %d, or 'todo toggle %d' to unlink it: %w",
+			task.JiraKey, task.ID, task.ID, err)
+	case jira.IsForbidden(err):
+		return fmt.Errorf("You don't have permission to change Jira issue %s: %w", task.JiraKey, err)
+	case apiErr.Errors["transition"] != "":
+		return fmt.Errorf(
+			"Jira doesn't allow changing the status of %s. Check the workflow of the project and your permissions: %w",
+			task.JiraKey, err)
+	}
+	return err
+}
+
+// record the change in the journal so it can be undone
+func (t *Todo) record(c change) {
+	if t.Journal == nil || c.entry == nil {
+		return
+	}
+	if !c.deleted {
+		c.entry.After = c.task.Clone()
+	}
+	if err := t.Journal.Append(c.entry); err != nil {
+		t.status("Unable to record %s in the journal, it can't be undone: %v", c.entry.Op, err)
+	}
+}
+
+// markSynced remembers the state of the task as the state of its Jira
+// issue once the change is saved on both sides
+func (t *Todo) markSynced(c change) {
+	if t.Synced == nil || c.task == nil {
+		return
+	}
+	var err error
+	switch {
+	case c.deleted || c.task.JiraKey == "":
+		err = t.Synced.Delete(c.task.ID)
+		if err == nil && t.Issues != nil {
+			err = t.Issues.Delete(c.task.ID)
+		}
+	case c.remote != nil:
+		err = t.Synced.Set(c.task)
+	}
+	if err != nil {
+		t.status("Unable to save the synced state of task %d: %v", c.task.ID, err)
+	}
+}
+
+// items are the notes or the time entries of a task, which are posted to
+// its issue one by one
+type items struct {
+	len int
+	// pending reports whether item i is still to be posted
+	pending func(i int) bool
+	// post posts item i and keeps the ID Jira gives it
+	post func(i int) error
+	// posted says what was done when the task can't be saved after it
+	posted string
+}
+
+// postItems posts the pending items of task in order. With save the task
+// is saved after every item, so a retry never posts one twice. Without, the
+// caller saves the task, as for an issue that was just created
+func (t *Todo) postItems(task *config.Task, it items, save bool) error {
+	for i := 0; i < it.len; i++ {
+		if !it.pending(i) {
+			continue
+		}
+		if err := it.post(i); err != nil {
+			return err
+		}
+		if !save {
+			continue
+		}
+		if err := t.Store.Update(task); err != nil {
+			return fmt.Errorf("%s Jira issue %s, but task %d could not be saved: %v",
+				it.posted, task.JiraKey, task.ID, err)
+		}
+	}
+	return nil
+}
+
+// repair offers to retry saving the task of an *OutOfSyncError until it
+// succeeds or the user gives up
+func (t *Todo) repair(e *OutOfSyncError) error {
+	w := t.stdout()
+	fmt.Fprintln(w, e)
+	var in io.Reader = os.Stdin
+	if t.In != nil {
+		in = t.In
+	}
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(w, "\nRetry saving task %d? (y/n): ", e.Task.ID)
+		answer, err := readLine(reader)
+		if err != nil || strings.TrimSpace(strings.ToLower(answer)) != "y" {
+			break
+		}
+		if err = e.Retry(); err == nil {
+			fmt.Fprintln(w, "Task saved, Jira and your todo list are in sync again")
+			return nil
+		}
+		fmt.Fprintf(w, "Unable to save task: %v\n", err)
+	}
+	return fmt.Errorf("Jira and your todo list are out of sync. %s", e.Repair)
+}
@@ -18,16 +18,22 @@ import (
 	"fmt"
 	"time"
 	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/outbox"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // completeCmd represents the complete command
 var completeCmd = &cobra.Command{
-	Use:   "complete",
+	Use:   "complete <id>",
 	Args:  cobra.ExactArgs(1),
-	Short: "Completes the task with the index supplied",
+	Short: "Completes the task with the ID supplied",
+	Long: `Completes a task. The task can be given by its ID, its Jira key or the
+beginning of its text as long as that matches only one task.
+
+Completing a recurring task adds its next occurrence, or moves the task to
+its next due date if its Jira issue is re-opened for every occurrence`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return t.Complete(args)
 	},
@@ -40,24 +46,38 @@ func init() {
 
 // Complete a task
 func (t *Todo) Complete(args []string) error {
-	var i int
-	var err error
-	if i, err = t.verifyIndex(args); err != nil {
+	task, err := t.findTask(args)
+	if err != nil {
 		return err
 	}
-	task := t.Config.Tasks[i]
 	if task.Done == true {
 		return fmt.Errorf("Task '%s' is already completed", task.Text)
 	}
-	fmt.Printf("Completing task: '%s'\n", task.Text)
+	t.status("Completing task: '%s'", task.Text)
+	if task.Recur != nil {
+		return t.completeOccurrence(task)
+	}
+	return t.apply(t.completion(task))
+}
+
+// completion returns the change completing task
+func (t *Todo) completion(task *config.Task) change {
+	c := change{
+		task:  task,
+		entry: &journal.Entry{Op: "complete", Before: task.Clone()},
+		local: func() error {
+			task.Done = true
+			task.Completed = time.Now()
+			return t.Store.Update(task)
+		},
+	}
 	if task.JiraID != "" {
-		err = t.JC.ChangeIssueStatus(task.JiraID, t.Config.Jira.Project.DoneID, "Closed by Todo")
-		if err != nil {
-			return fmt.Errorf("Unable to change Jira status: %v", err)
-		}
+		c.remote = func() error { return t.transition(task, true) }
+		c.rollback = func() error { return t.transition(task, false) }
+		c.queue = func() []*outbox.Op { return transitionOps(task, true) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was closed", task.JiraKey) }
+		c.repair = fmt.Sprintf(
+			"Re-open %s in Jira and run 'todo complete %d' again.", task.JiraKey, task.ID)
 	}
-	task.Done = true
-	task.Completed = time.Now()
-	config.Write(viper.ConfigFileUsed(), &t.Config)
-	return nil
+	return c
 }
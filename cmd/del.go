@@ -16,17 +16,21 @@ package cmd
 
 import (
 	"fmt"
+	"jira"
 	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/outbox"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // delCmd represents the del command
 var delCmd = &cobra.Command{
-	Use:   "del",
+	Use:   "del <id>",
 	Args:  cobra.ExactArgs(1),
-	Short: "Deletes the task with the index supplied from your todo list",
+	Short: "Deletes the task with the ID supplied from your todo list",
+	Long: `Deletes a task. The task can be given by its ID, its Jira key or the
+beginning of its text as long as that matches only one task`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return t.Del(args)
 	},
@@ -38,21 +42,42 @@ func init() {
 
 // Del will remove a task
 func (t *Todo) Del(args []string) error {
-	var i int
-	var err error
-	if i, err = t.verifyIndex(args); err != nil {
+	task, err := t.findTask(args)
+	if err != nil {
 		return err
 	}
-	task := t.Config.Tasks[i]
-	fmt.Printf("Deleting task: '%s'\n", task.Text)
+	t.status("Deleting task: '%s'", task.Text)
+	c := change{
+		task:    task,
+		local:   func() error { return t.Store.Delete(task.ID) },
+		entry:   &journal.Entry{Op: "del", Before: task.Clone()},
+		deleted: true,
+	}
 	if task.JiraKey != "" {
-		err = t.JC.DeleteIssue(task.JiraID)
-		if err != nil {
-			return fmt.Errorf("Unable to delete Jira issue: %v", err)
+		c.remote = func() error {
+			err := t.deleteIssue(task)
+			if jira.IsNotFound(err) {
+				t.status("Jira issue %s was already deleted", task.JiraKey)
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("Unable to delete Jira issue: %w", err)
+			}
+			return nil
 		}
+		c.queue = func() []*outbox.Op { return deleteOps(task) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was deleted", task.JiraKey) }
+		c.repair = fmt.Sprintf(
+			"Run 'todo toggle %d' to unlink the task and then 'todo del %d' again.", task.ID, task.ID)
 	}
-	t.Config.Tasks = append(t.Config.Tasks[:i], t.Config.Tasks[i+1:]...)
-	config.Write(viper.ConfigFileUsed(), &t.Config)
+	return t.apply(c)
+}
 
-	return nil
+// deleteIssue deletes the Jira issue of task
+func (t *Todo) deleteIssue(task *config.Task) error {
+	jc, _, err := t.jiraFor(task)
+	if err != nil {
+		return err
+	}
+	return jc.DeleteIssueContext(t.ctx(), task.JiraID)
 }
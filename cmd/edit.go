@@ -0,0 +1,259 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/outbox"
+	"todo/internal/when"
+
+	"github.com/spf13/cobra"
+)
+
+// editCmd represents the edit command
+var editCmd = &cobra.Command{
+	Use:   "edit <id> [new text]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Changes the supplied task",
+	Long: `Changes the text of a task and the fields given as flags. Linked Jira issues
+are updated as well, the text is synced to the issue summary and tags to the
+issue labels. The new text may contain +tags, @contexts and a !priority like
+the text given to 'todo add'.
+
+With -e the task is opened in $EDITOR, after the flags are applied.
+
+Dates accept e.g. "tomorrow", "fri 17:00", "next monday", "+3d" or "2018-05-01".
+Use "none" to clear a date, and --every none to stop a task from recurring`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		editor, _ := cmd.Flags().GetBool("editor")
+		return t.Edit(args[:1], func(task *config.Task) error {
+			if len(args) > 1 {
+				if err := setText(task, strings.Join(args[1:], " ")); err != nil {
+					return err
+				}
+			}
+			if err := setFields(cmd, task); err != nil {
+				return err
+			}
+			if editor {
+				return editTask(task)
+			}
+			return nil
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+	editCmd.Flags().String("due", "", "Due date")
+	editCmd.Flags().String("start", "", "Start date, the task is hidden until then")
+	editCmd.Flags().StringP("priority", "p", "", "Priority [Highest, High, Medium, Low, Lowest, A-E or none]")
+	editCmd.Flags().StringSliceP("tag", "t", nil, "Add a tag, can be repeated")
+	editCmd.Flags().StringSlice("untag", nil, "Remove a tag, can be repeated")
+	editCmd.Flags().Bool("done", false, "Mark the task as completed, --done=false re-opens it")
+	editCmd.Flags().String("every", "", "Repeat the task, e.g. \"fri\", \"2w\", \"15th\" or an RRULE. \"none\" stops it")
+	editCmd.Flags().Bool("reopen", false, "Re-open the Jira issue for the next occurrence instead of creating a new one")
+	editCmd.Flags().BoolP("editor", "e", false, "Edit the task in $EDITOR")
+}
+
+// setText replaces the text of task with text. Inline tags are added to
+// the existing ones and an inline priority replaces the current one
+func setText(task *config.Task, text string) error {
+	inline, err := parseInline(text)
+	if err != nil {
+		return err
+	}
+	task.Text = inline.Text
+	task.Tags = addTags(task.Tags, inline.Tags...)
+	if inline.Priority != "" {
+		task.Priority = inline.Priority
+	}
+	return nil
+}
+
+// Edit the supplied task. update is called with a copy of the task and the
+// copy is saved, and mirrored to Jira, if update succeeds
+func (t *Todo) Edit(args []string, update func(*config.Task) error) error {
+	current, err := t.findTask(args)
+	if err != nil {
+		return err
+	}
+	task := current.Clone()
+	if err = update(task); err != nil {
+		return err
+	}
+	if err = scheduleRecurrence(task, time.Now()); err != nil {
+		return err
+	}
+	if task.Text == "" {
+		return fmt.Errorf("Your todo can't be empty")
+	}
+	if reflect.DeepEqual(task, current) {
+		return fmt.Errorf("Nothing to change")
+	}
+	t.status("Editing task: '%s'", task.Text)
+	c := change{
+		task:  task,
+		local: func() error { return t.Store.Update(task) },
+		entry: &journal.Entry{Op: "edit", Before: current.Clone()},
+	}
+	if task.JiraID != "" && len(jiraChanges(current, task)) > 0 {
+		c.remote = func() error { return t.updateJira(current, task) }
+		c.rollback = func() error { return t.updateJira(task, current) }
+		c.queue = func() []*outbox.Op { return updateOps(current, task) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was updated", task.JiraKey) }
+		c.repair = fmt.Sprintf("Edit %s in Jira and run 'todo edit %d' again.", task.JiraKey, task.ID)
+	}
+	return t.apply(c)
+}
+
+// updateJira changes the issue of a task from the state in from to the
+// state in to. Both must be linked to the same issue
+func (t *Todo) updateJira(from, to *config.Task) error {
+	if fields := jiraChanges(from, to); len(fields) > 0 {
+		jc, _, err := t.jiraFor(to)
+		if err != nil {
+			return err
+		}
+		if err := jc.UpdateIssueContext(t.ctx(), to.JiraID, fields); err != nil {
+			return fmt.Errorf("Unable to update Jira issue: %w", err)
+		}
+	}
+	if from.Done != to.Done {
+		return t.transition(to, to.Done)
+	}
+	return nil
+}
+
+// jiraChanges returns the issue fields that differ between from and to
+func jiraChanges(from, to *config.Task) map[string]interface{} {
+	before := issueFields(from)
+	changes := map[string]interface{}{}
+	for k, v := range issueFields(to) {
+		if !reflect.DeepEqual(before[k], v) {
+			changes[k] = v
+		}
+	}
+	return changes
+}
+
+// setFields sets the fields of task from the flags given to cmd. Flags
+// that were not given leave the field as it is
+func setFields(cmd *cobra.Command, task *config.Task) error {
+	if err := setDates(cmd, task); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("priority") {
+		s, _ := cmd.Flags().GetString("priority")
+		p, err := config.ParsePriority(s)
+		if err != nil {
+			return err
+		}
+		task.Priority = p
+	}
+	if cmd.Flags().Changed("tag") {
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		for _, tag := range tags {
+			if strings.ContainsAny(tag, " \t") {
+				return fmt.Errorf("Tags can't contain spaces: '%s'", tag)
+			}
+		}
+		task.Tags = addTags(task.Tags, tags...)
+	}
+	if cmd.Flags().Changed("untag") {
+		tags, _ := cmd.Flags().GetStringSlice("untag")
+		task.Tags = removeTags(task.Tags, tags...)
+	}
+	if cmd.Flags().Changed("done") {
+		done, _ := cmd.Flags().GetBool("done")
+		setDone(task, done)
+	}
+	return setRecurrence(cmd, task)
+}
+
+// setDone completes or re-opens task
+func setDone(task *config.Task, done bool) {
+	if task.Done == done {
+		return
+	}
+	task.Done = done
+	task.Completed = time.Time{}
+	if done {
+		task.Completed = time.Now()
+	}
+}
+
+// addTags returns tags with the new tags added, ignoring duplicates and a
+// leading '+'
+func addTags(tags []string, add ...string) []string {
+	task := &config.Task{Tags: tags}
+	for _, tag := range add {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "+")
+		if tag != "" && !task.HasTag(tag) {
+			task.Tags = append(task.Tags, tag)
+		}
+	}
+	return task.Tags
+}
+
+// removeTags returns tags without the supplied ones
+func removeTags(tags []string, remove ...string) []string {
+	drop := &config.Task{}
+	drop.Tags = addTags(nil, remove...)
+	var kept []string
+	for _, tag := range tags {
+		if !drop.HasTag(tag) {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+// setDates sets the due and start dates of task from the --due and
+// --start flags of cmd, if they were given
+func setDates(cmd *cobra.Command, task *config.Task) error {
+	now := time.Now()
+	if cmd.Flags().Changed("due") {
+		s, _ := cmd.Flags().GetString("due")
+		d, err := parseDate(s, now, when.Due)
+		if err != nil {
+			return fmt.Errorf("Invalid due date: %v", err)
+		}
+		task.Due = d
+	}
+	if cmd.Flags().Changed("start") {
+		s, _ := cmd.Flags().GetString("start")
+		d, err := parseDate(s, now, when.Start)
+		if err != nil {
+			return fmt.Errorf("Invalid start date: %v", err)
+		}
+		task.Start = d
+	}
+	return nil
+}
+
+// parseDate parses s with parse. "none" or an empty string clear the date
+func parseDate(s string, now time.Time, parse func(string, time.Time) (time.Time, error)) (time.Time, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none":
+		return time.Time{}, nil
+	}
+	return parse(s, now)
+}
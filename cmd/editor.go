@@ -0,0 +1,202 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+	"todo/internal/config"
+	"todo/internal/when"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// editForm is the part of a task that can be changed in $EDITOR
+type editForm struct {
+	Text     string   `yaml:"text"`
+	Priority string   `yaml:"priority"`
+	Tags     []string `yaml:"tags,flow"`
+	Due      string   `yaml:"due"`
+	Start    string   `yaml:"start"`
+	Done     bool     `yaml:"done"`
+}
+
+const editHeader = `# Editing task %d%s. Save and quit to apply the changes, or empty the
+# file to leave the task as it is. Dates accept e.g. "tomorrow", "fri 17:00",
+# "+3d" or "2018-05-01", leave them empty for none
+`
+
+// EditInEditor opens the supplied task in $EDITOR and saves the changes
+func (t *Todo) EditInEditor(args []string) error {
+	return t.Edit(args, editTask)
+}
+
+// editTask lets the user change task in $EDITOR. The editor is opened
+// again as long as what was saved can't be parsed
+func editTask(task *config.Task) error {
+	f, err := ioutil.TempFile("", fmt.Sprintf("todo-%d-*.yaml", task.ID))
+	if err != nil {
+		return fmt.Errorf("Unable to create file to edit: %v", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	content, err := renderTask(task)
+	if err == nil {
+		_, err = f.Write(content)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to write file to edit: %v", err)
+	}
+
+	for {
+		if err = runEditor(path); err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Unable to read edited file: %v", err)
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			return fmt.Errorf("Edit aborted, the file was empty")
+		}
+		err = parseTask(b, task)
+		if err == nil {
+			return nil
+		}
+		if !isTerminal(os.Stdin) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%v\nPress enter to fix it in the editor again or ctrl-c to give up", err)
+		fmt.Fscanln(os.Stdin)
+		// Keep the comment at the top so the error can be fixed in place
+		b = append([]byte(fmt.Sprintf("# %s\n", strings.Replace(err.Error(), "\n", " ", -1))), b...)
+		if err = ioutil.WriteFile(path, b, 0600); err != nil {
+			return fmt.Errorf("Unable to write file to edit: %v", err)
+		}
+	}
+}
+
+// renderTask returns task as yaml for editing
+func renderTask(task *config.Task) ([]byte, error) {
+	form := editForm{
+		Text:     task.Text,
+		Priority: task.Priority,
+		Tags:     task.Tags,
+		Due:      formatDue(task.Due),
+		Start:    formatStart(task.Start),
+		Done:     task.Done,
+	}
+	if form.Tags == nil {
+		form.Tags = []string{}
+	}
+	b, err := yaml.Marshal(form)
+	if err != nil {
+		return nil, err
+	}
+	var key string
+	if task.JiraKey != "" {
+		key = fmt.Sprintf(" (%s)", task.JiraKey)
+	}
+	return append([]byte(fmt.Sprintf(editHeader, task.ID, key)), b...), nil
+}
+
+// parseTask sets the fields of task from the edited yaml in b
+func parseTask(b []byte, task *config.Task) error {
+	var form editForm
+	if err := yaml.UnmarshalStrict(b, &form); err != nil {
+		return fmt.Errorf("Unable to parse task: %v", err)
+	}
+	text := strings.Join(strings.Fields(form.Text), " ")
+	if text == "" {
+		return fmt.Errorf("Your todo can't be empty")
+	}
+	p, err := config.ParsePriority(form.Priority)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	due, err := parseDate(form.Due, now, when.Due)
+	if err != nil {
+		return fmt.Errorf("Invalid due date: %v", err)
+	}
+	start, err := parseDate(form.Start, now, when.Start)
+	if err != nil {
+		return fmt.Errorf("Invalid start date: %v", err)
+	}
+	for _, tag := range form.Tags {
+		if strings.ContainsAny(tag, " \t") {
+			return fmt.Errorf("Tags can't contain spaces: '%s'", tag)
+		}
+	}
+	task.Text = text
+	task.Priority = p
+	task.Tags = addTags(nil, form.Tags...)
+	// Keep the dates as they were if they were not changed, the rendering
+	// drops seconds
+	if formatDue(due) != formatDue(task.Due) {
+		task.Due = due
+	}
+	if formatStart(start) != formatStart(task.Start) {
+		task.Start = start
+	}
+	setDone(task, form.Done)
+	return nil
+}
+
+// formatStart leaves out the time of start dates at midnight
+func formatStart(d time.Time) string {
+	switch {
+	case d.IsZero():
+		return ""
+	case d.Equal(when.StartOfDay(d)):
+		return d.Format("2006-01-02")
+	}
+	return d.Format("2006-01-02 15:04")
+}
+
+// runEditor opens path in $VISUAL or $EDITOR and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	// The editor may be given with arguments, e.g. "code --wait"
+	args := append(strings.Fields(editor), path)
+	cmd := exec.Command(args[0], args[1:]...)
+	// Stdout may be redirected for --output, the editor needs the terminal
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	defer waitForUser(editing)()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Unable to run editor '%s': %v", editor, err)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jira"
+	"time"
+	"todo/internal/config"
+	"todo/internal/outbox"
+
+	"github.com/spf13/cobra"
+)
+
+// flushCmd represents the flush command
+var flushCmd = &cobra.Command{
+	Use:   "flush",
+	Args:  cobra.NoArgs,
+	Short: "Sends the queued changes to Jira",
+	Long: `Sends the changes that were queued while Jira couldn't be reached, in the order
+they were made. If Jira still can't be reached it is retried a few times,
+waiting longer between every attempt.
+
+Changes Jira rejects are kept in the queue, but not sent again. They are shown
+by 'todo status' and removed with --discard.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		discard, _ := cmd.Flags().GetBool("discard")
+		if discard {
+			return t.Discard()
+		}
+		retries, _ := cmd.Flags().GetInt("retries")
+		return t.Flush(retries)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(flushCmd)
+	flushCmd.Flags().Int("retries", 3, "Number of retries while Jira can't be reached")
+	flushCmd.Flags().Bool("discard", false, "Remove the changes Jira rejected from the queue")
+}
+
+// flushDelay is the wait before the first retry of a flush
+var flushDelay = time.Second
+
+// Flush replays the queued changes. While Jira can't be reached it is
+// retried up to retries times
+func (t *Todo) Flush(retries int) error {
+	if t.Outbox == nil {
+		return fmt.Errorf("No outbox available")
+	}
+	pending := len(t.Outbox.Pending())
+	if pending == 0 {
+		t.status("No queued changes")
+		return nil
+	}
+	// Changes rejected by an earlier flush are not reported again
+	rejected := len(t.Outbox.Ops()) - pending
+	delay := flushDelay
+	for attempt := 0; ; attempt++ {
+		err := t.replayAll(false)
+		if err == nil {
+			break
+		}
+		if attempt >= retries {
+			return fmt.Errorf("Jira can't be reached, %d changes are still queued: %v",
+				len(t.Outbox.Pending()), err)
+		}
+		t.status("Jira can't be reached, retrying in %v", delay)
+		select {
+		case <-t.ctx().Done():
+			return t.ctx().Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	failed := len(t.Outbox.Ops()) - rejected
+	t.status("Sent %d changes to Jira", pending-failed)
+	if failed > 0 {
+		return fmt.Errorf("Jira rejected %d changes. Run 'todo status' to see them", failed)
+	}
+	return nil
+}
+
+// Discard removes the changes Jira rejected from the outbox
+func (t *Todo) Discard() error {
+	if t.Outbox == nil {
+		return fmt.Errorf("No outbox available")
+	}
+	n := 0
+	for _, op := range t.Outbox.Ops() {
+		if !op.Failed {
+			continue
+		}
+		if err := t.Outbox.Remove(op.Seq); err != nil {
+			return fmt.Errorf("Unable to save outbox: %v", err)
+		}
+		n++
+	}
+	t.status("Discarded %d rejected changes", n)
+	return nil
+}
+
+// autoFlush sends the queued changes that are due before a command runs.
+// Failures are only reported, the command runs either way
+func (t *Todo) autoFlush() {
+	if t.Outbox == nil || t.JC == nil || len(t.Outbox.Pending()) == 0 {
+		return
+	}
+	if err := t.replayAll(true); err != nil {
+		t.status("Queued changes were not sent to Jira: %v", err)
+	}
+}
+
+// replayAll replays the pending operations in order. It stops at the first
+// one that fails because Jira can't be reached, or that isn't due yet when
+// due is set. Operations Jira rejects are marked as failed
+func (t *Todo) replayAll(due bool) error {
+	for _, op := range t.Outbox.Pending() {
+		if due && time.Now().Before(op.NextTry) {
+			return nil
+		}
+		err := t.replay(op)
+		switch {
+		case err == nil:
+			err = t.Outbox.Remove(op.Seq)
+		case errors.Is(err, context.Canceled):
+			return err
+		case jira.IsNetworkError(err):
+			if serr := t.Outbox.Retry(op, err); serr != nil {
+				return fmt.Errorf("Unable to save outbox: %v", serr)
+			}
+			return err
+		default:
+			t.status("Jira rejected the %s of task %d: %v", op.Kind, op.TaskID, err)
+			err = t.Outbox.Fail(op, err)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to save outbox: %v", err)
+		}
+	}
+	return nil
+}
+
+// replay sends one queued operation to Jira
+func (t *Todo) replay(op *outbox.Op) error {
+	if op.Kind == outbox.Delete {
+		err := t.deleteIssue(&config.Task{ID: op.TaskID, JiraID: op.JiraID, Profile: op.Profile})
+		if jira.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	task, err := t.taskByID(op.TaskID)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		// Deleted locally after the change was queued
+		return nil
+	}
+	switch op.Kind {
+	case outbox.Create:
+		if task.JiraID != "" {
+			if err := t.postItems(task, t.noteItems(task), true); err != nil {
+				return err
+			}
+			return t.postItems(task, t.worklogItems(task), true)
+		}
+		return t.replayCreate(task)
+	case outbox.Update:
+		jc, _, err := t.jiraFor(task)
+		if err != nil {
+			return err
+		}
+		if err := jc.UpdateIssueContext(t.ctx(), task.JiraID, op.Fields); err != nil {
+			return fmt.Errorf("Unable to update Jira issue: %w", err)
+		}
+	case outbox.Transition:
+		return t.transition(task, op.Done)
+	case outbox.Comment:
+		return t.postItems(task, t.noteItems(task), true)
+	case outbox.Worklog:
+		return t.postItems(task, t.worklogItems(task), true)
+	default:
+		return fmt.Errorf("Unknown operation '%s'", op.Kind)
+	}
+	return nil
+}
+
+// replayCreate creates the issue of task and links the task to it. The task
+// is linked before the issue is closed and the notes and the time are
+// added, so a retry never creates it twice
+func (t *Todo) replayCreate(task *config.Task) error {
+	if err := t.createJira(task); err != nil {
+		return err
+	}
+	if err := t.Store.Update(task); err != nil {
+		return fmt.Errorf("Jira issue %s was created, but task %d could not be linked to it: %v",
+			task.JiraKey, task.ID, err)
+	}
+	if task.Done {
+		if err := t.transition(task, true); err != nil {
+			return err
+		}
+	}
+	if err := t.postItems(task, t.noteItems(task), true); err != nil {
+		return err
+	}
+	if err := t.postItems(task, t.worklogItems(task), true); err != nil {
+		return err
+	}
+	if t.Synced != nil {
+		if err := t.Synced.Set(task); err != nil {
+			t.status("Unable to save the synced state of task %d: %v", task.ID, err)
+		}
+	}
+	return nil
+}
+
+// createOps queues the creation of the issue of task
+func createOps(task *config.Task) []*outbox.Op {
+	return []*outbox.Op{{Kind: outbox.Create, TaskID: task.ID}}
+}
+
+// transitionOps queues completing or re-opening the issue of task
+func transitionOps(task *config.Task, done bool) []*outbox.Op {
+	return []*outbox.Op{{Kind: outbox.Transition, TaskID: task.ID, JiraKey: task.JiraKey, Done: done}}
+}
+
+// commentOps queues adding note to the issue of task
+func commentOps(task *config.Task, note config.Note) []*outbox.Op {
+	return []*outbox.Op{{Kind: outbox.Comment, Time: note.Time, TaskID: task.ID, JiraKey: task.JiraKey}}
+}
+
+// deleteOps queues the deletion of the issue of task
+func deleteOps(task *config.Task) []*outbox.Op {
+	return []*outbox.Op{{Kind: outbox.Delete, TaskID: task.ID, JiraID: task.JiraID, JiraKey: task.JiraKey, Profile: task.Profile}}
+}
+
+// updateOps queues the changes updateJira would make
+func updateOps(from, to *config.Task) []*outbox.Op {
+	var ops []*outbox.Op
+	if fields := jiraChanges(from, to); len(fields) > 0 {
+		ops = append(ops, &outbox.Op{Kind: outbox.Update, TaskID: to.ID, JiraKey: to.JiraKey, Fields: fields})
+	}
+	if from.Done != to.Done {
+		ops = append(ops, transitionOps(to, to.Done)...)
+	}
+	return ops
+}
@@ -17,15 +17,17 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"jira"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"todo/internal/config"
 
 	"github.com/dghubble/oauth1"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
 )
 
 // initCmd represents the init command
@@ -35,20 +37,232 @@ var initCmd = &cobra.Command{
 	Long: `init will guide you through the setup to get your todo tool to work.
 
 You will be asked to supply the URL to the JIRA installation you want to work
-against. Your credentials will not be stored anywhere. Only thing getting stored
-is an OAuth token which will then be used for any future authentications against
-Jira`,
+against and how to authenticate, chosen with --auth:
+
+  oauth1  an OAuth token from an application link set up by a Jira admin (default)
+  basic   the email of your account and an API token, for Jira Cloud
+  pat     a personal access token, for Jira Server and Data Center
+
+Your password is not stored anywhere. The token is stored encrypted with your
+private RSA key. Without an application link key todo generates one for that
+
+Every question can be answered up front with a flag, or an environment
+variable like TODO_URL for --url, so init can run without asking anything:
+
+  todo init --auth pat --url https://jira.company.com --token-file token.txt \
+    --project PRJ --done-status Done
+
+An OAuth token can be obtained in two steps without a prompt as well. The
+first prints where to give todo access, the second takes the verification
+code Jira shows:
+
+  todo init --url https://jira.company.com --print-authorize-url
+  todo init --verifier XXXXXX --project PRJ --done-status Done`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return t.SetupJira()
+		return t.SetupJira(initOptions(cmd))
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(initCmd)
+	addInitFlags(initCmd)
+}
+
+// addInitFlags adds the flags answering the questions of init to cmd
+func addInitFlags(cmd *cobra.Command) {
+	cmd.Flags().String("auth", config.AuthOAuth1, "How to authenticate [oauth1, basic, pat]")
+	cmd.Flags().String("url", "", "URL of Jira")
+	cmd.Flags().String("user", "", "Email of your Jira account, for --auth basic")
+	cmd.Flags().String("token-file", "", "File with an OAuth access token, API token or personal access token to use")
+	cmd.Flags().String("project", "", "Key of the Jira project to use")
+	cmd.Flags().String("done-status", "", "Status to move completed issues to")
+	cmd.Flags().String("reopen-status", "", "Status to move reopened issues to (default the nearest status in the To Do category)")
+	cmd.Flags().String("issue-type", "", "Issue type of new issues (default the type of the latest issue)")
+	cmd.Flags().Bool("print-authorize-url", false, "Print where to give todo OAuth access, and finish later with --verifier")
+	cmd.Flags().String("verifier", "", "Verification code shown by Jira after --print-authorize-url")
+}
+
+// initOptions returns the answers given with the flags of addInitFlags
+func initOptions(cmd *cobra.Command) InitOptions {
+	printURL, _ := cmd.Flags().GetBool("print-authorize-url")
+	return InitOptions{
+		Auth:              initFlag(cmd, "auth"),
+		URL:               initFlag(cmd, "url"),
+		User:              initFlag(cmd, "user"),
+		TokenFile:         initFlag(cmd, "token-file"),
+		Project:           initFlag(cmd, "project"),
+		DoneStatus:        initFlag(cmd, "done-status"),
+		ReopenStatus:      initFlag(cmd, "reopen-status"),
+		IssueType:         initFlag(cmd, "issue-type"),
+		PrintAuthorizeURL: printURL,
+		Verifier:          initFlag(cmd, "verifier"),
+	}
+}
+
+// InitOptions are answers given up front to the questions of init. Empty
+// ones are asked for
+type InitOptions struct {
+	Auth         string
+	URL          string
+	User         string
+	TokenFile    string
+	Project      string
+	DoneStatus   string
+	ReopenStatus string
+	IssueType    string
+	// PrintAuthorizeURL makes init stop after printing where to authorize
+	// the OAuth request token. It is finished by running it with Verifier
+	PrintAuthorizeURL bool
+	Verifier          string
+}
+
+// initFlag returns the value of the flag, or of its TODO_ environment
+// variable if the flag isn't given
+func initFlag(cmd *cobra.Command, name string) string {
+	value, _ := cmd.Flags().GetString(name)
+	if cmd.Flags().Changed(name) {
+		return value
+	}
+	env := "TODO_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+	if v, ok := os.LookupEnv(env); ok {
+		return v
+	}
+	return value
+}
+
+// stdin is shared by the prompts, so input piped to todo isn't lost
+// between them
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt asks for a value, and asks again while the answer is empty
+func prompt(label string) (string, error) {
+	for {
+		fmt.Print(label)
+		answer, err := readLine(stdin)
+		if err != nil {
+			return "", fmt.Errorf("Unable to read input: %v", err)
+		}
+		if answer = strings.TrimSpace(answer); answer != "" {
+			return answer, nil
+		}
+	}
+}
+
+// answer returns value, or asks for it if it's empty
+func answer(value, label string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	return prompt(label)
+}
+
+// SetupJira authenticates as opts.Auth says and lets the user choose a
+// project, asking for what opts doesn't answer
+func (t *Todo) SetupJira(opts InitOptions) error {
+	fmt.Printf("Initalizing todo...\n\n")
+	if opts.Auth == "" {
+		opts.Auth = config.AuthOAuth1
+	}
+	if (opts.PrintAuthorizeURL || opts.Verifier != "") && opts.Auth != config.AuthOAuth1 {
+		return fmt.Errorf("--print-authorize-url and --verifier are only used with --auth oauth1")
+	}
+	var err error
+	switch opts.Auth {
+	case config.AuthOAuth1:
+		if opts.PrintAuthorizeURL {
+			return t.printAuthorizeURL(opts)
+		}
+		err = t.setupOAuth(opts)
+	case config.AuthBasic, config.AuthPAT:
+		err = t.setupToken(opts)
+	default:
+		return fmt.Errorf("Invalid auth method '%s'. Valid options are: [oauth1, basic, pat]", opts.Auth)
+	}
+	if err != nil {
+		return err
+	}
+
+	p, err := t.chooseProject(opts.Project)
+	if jira.IsUnauthorized(err) {
+		return fmt.Errorf("Jira didn't accept the credentials: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to choose Jira project: %w", err)
+	}
+
+	issueType, err := t.chooseIssueType(p.Key, opts.IssueType)
+	if err != nil {
+		return fmt.Errorf("Unable to choose issue type: %w", err)
+	}
+	done, reopen, err := t.chooseStatuses(p.Key, issueType, opts)
+	if err != nil {
+		return fmt.Errorf("Unable to choose statuses: %w", err)
+	}
+	secret := t.JC.Token
+	switch a := t.JC.Auth.(type) {
+	case *jira.BasicAuth:
+		secret = a.Token
+	case *jira.BearerAuth:
+		secret = a.Token
+	}
+	token, err := config.Encrypt(&t.PrivateKey.PublicKey, secret)
+	if err != nil {
+		return err
+	}
+	j := &config.Jira{URL: t.JC.BaseURL, Auth: opts.Auth, Token: token}
+	if a, ok := t.JC.Auth.(*jira.BasicAuth); ok {
+		j.User = a.User
+	}
+	if opts.Auth == config.AuthOAuth1 {
+		if j.Session, err = config.Encrypt(&t.PrivateKey.PublicKey, t.JC.Session); err != nil {
+			return err
+		}
+	}
+	j.Project = config.Project{
+		Name:         p.Name,
+		DoneStatus:   done,
+		ReopenStatus: reopen,
+		ID:           p.ID,
+		IssueType:    issueType,
+		Key:          p.Key,
+	}
+	// Tasks, settings and the other profiles are kept
+	if t.Config == nil {
+		t.Config = &config.Cfg{}
+	}
+	if t.Profile == "" {
+		t.Config.Jira = *j
+	} else {
+		if t.Config.Profiles == nil {
+			t.Config.Profiles = map[string]*config.Jira{}
+		}
+		t.Config.Profiles[t.Profile] = j
+	}
+	if t.ConfigFile == nil {
+		path, err := configPath()
+		if err != nil {
+			return err
+		}
+		if t.ConfigFile, err = config.Open(path); err != nil {
+			return err
+		}
+	}
+	err = t.ConfigFile.Write(t.Config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nInitialization done! Enjoy the tool\n")
+	return nil
 }
 
-//SetupJira and generate a valid oauth token
-func (t *Todo) SetupJira() error {
+// newOAuthClient returns a client signing with the application link key
+func (t *Todo) newOAuthClient() error {
+	if t.PrivateKey == nil {
+		return fmt.Errorf("OAuth needs the private key of the Jira application link. Use --privkey, or --auth basic or pat")
+	}
+	if err := config.CheckKey(&t.PrivateKey.PublicKey); err != nil {
+		return err
+	}
 	t.JC = jira.NewClient(&oauth1.Config{
 		CallbackURL:    "oob",
 		ConsumerKey:    "Todo",
@@ -59,130 +273,418 @@ func (t *Todo) SetupJira() error {
 		},
 	})
 	t.JC.PrivateKey = t.PrivateKey
-	fmt.Printf("Initalizing todo...\n\n")
-	err := t.JC.GenerateOauthToken()
+	t.JC.HTTPClient.Timeout = t.Timeout
+	return nil
+}
+
+// askURL sets the URL of the client to url, or asks for it
+func (t *Todo) askURL(url string) error {
+	answer, err := answer(url, "Enter Jira URL: ")
+	if err != nil {
+		return err
+	}
+	if t.JC.BaseURL, err = jira.VerifyURL(answer); err != nil {
+		return fmt.Errorf("Invalid Jira URL: %v", err)
+	}
+	return nil
+}
+
+// setupOAuth gets an OAuth access token through the application link, or
+// uses the one in opts.TokenFile
+func (t *Todo) setupOAuth(opts InitOptions) error {
+	if err := t.newOAuthClient(); err != nil {
+		return err
+	}
+	var err error
+	switch {
+	case opts.TokenFile != "":
+		if err = t.askURL(opts.URL); err != nil {
+			return err
+		}
+		t.JC.Token, err = readTokenFile(opts.TokenFile)
+		return err
+	case opts.Verifier != "":
+		err = t.finishAuthorization(opts.Verifier)
+	default:
+		err = t.authorize(opts.URL)
+	}
 	if err != nil {
 		return fmt.Errorf(`Unable to generate oauth token!
 Make sure you use the correct Jira URL and that you have set up the application link:
 %v`, err)
 	}
 	fmt.Printf("\nGreat! Authentication succesful! Let's proceed...\n")
+	return nil
+}
+
+// authorize asks the user to give todo access and waits until it's done
+func (t *Todo) authorize(url string) error {
+	if err := t.askURL(url); err != nil {
+		return err
+	}
+	requestToken, err := t.JC.RequestTokenContext(t.ctx(), "")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nVisit %s and give the tool access\n\n", t.JC.AuthorizeURL(requestToken))
+	for {
+		done, err := prompt("Are you done? (y/n): ")
+		if err != nil {
+			return err
+		}
+		if strings.ToLower(done) == "y" {
+			break
+		}
+	}
+	return t.JC.AccessTokenContext(t.ctx(), requestToken)
+}
+
+// pendingAuthorization is a request token waiting for --verifier
+type pendingAuthorization struct {
+	URL          string `yaml:"url"`
+	RequestToken string `yaml:"request_token"`
+}
 
-	p, err := t.chooseProject()
+// pendingAuthorizationPath is where the request token is kept between
+// --print-authorize-url and --verifier, next to the config file
+func (t *Todo) pendingAuthorizationPath() (string, error) {
+	if t.ConfigFile != nil {
+		return filepath.Join(filepath.Dir(t.ConfigFile.Path()), "todo.authorize"), nil
+	}
+	path, err := configPath()
 	if err != nil {
-		return fmt.Errorf("Unable to choose Jira project: %v", err)
+		return "", err
 	}
+	return filepath.Join(filepath.Dir(path), "todo.authorize"), nil
+}
 
-	s, backlog, issueType, err := t.chooseDoneStatus(p.Key)
+// printAuthorizeURL requests a token to be authorized by the user and
+// prints where to do it
+func (t *Todo) printAuthorizeURL(opts InitOptions) error {
+	if err := t.newOAuthClient(); err != nil {
+		return err
+	}
+	if err := t.askURL(opts.URL); err != nil {
+		return err
+	}
+	requestToken, err := t.JC.RequestTokenContext(t.ctx(), "oob")
 	if err != nil {
-		return fmt.Errorf("Unable to choose Jira project: %v", err)
+		return fmt.Errorf("Unable to start the authorization. Is the application link set up?\n%w", err)
 	}
-	token, err := config.Encrypt(&t.PrivateKey.PublicKey, t.JC.Token)
+	b, err := yaml.Marshal(&pendingAuthorization{URL: t.JC.BaseURL, RequestToken: requestToken})
 	if err != nil {
 		return err
 	}
-	session, err := config.Encrypt(&t.PrivateKey.PublicKey, t.JC.Session)
+	path, err := t.pendingAuthorizationPath()
 	if err != nil {
 		return err
 	}
-	t.Config = &config.Cfg{}
-	t.Config.Jira.URL = t.JC.BaseURL
-	t.Config.Jira.Token = token
-	t.Config.Jira.Session = session
-	t.Config.Jira.Project = config.Project{
-		Name:      p.Name,
-		DoneID:    s.ID,
-		BacklogID: backlog.ID,
-		ID:        p.ID,
-		IssueType: issueType,
-		Key:       p.Key,
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return fmt.Errorf("Unable to save the request token: %v", err)
 	}
-	err = config.Write(viper.ConfigFileUsed(), t.Config)
+	fmt.Printf("Visit %s and give the tool access.\n", t.JC.AuthorizeURL(requestToken))
+	fmt.Printf("Then run 'todo init --verifier <code>' with the verification code Jira shows\n")
+	return nil
+}
+
+// finishAuthorization gets an access token for the request token saved by
+// printAuthorizeURL
+func (t *Todo) finishAuthorization(verifier string) error {
+	path, err := t.pendingAuthorizationPath()
 	if err != nil {
 		return err
 	}
-	fmt.Printf("\nInitialization done! Enjoy the tool\n")
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("No authorization to finish. Run 'todo init --print-authorize-url' first")
+	}
+	if err != nil {
+		return err
+	}
+	pending := &pendingAuthorization{}
+	if err := yaml.Unmarshal(b, pending); err != nil {
+		return fmt.Errorf("Unable to read %s: %v", path, err)
+	}
+	t.JC.BaseURL = pending.URL
+	if err := t.JC.AccessTokenVerifierContext(t.ctx(), pending.RequestToken, verifier); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// readTokenFile reads a token stored in a file by itself
+func readTokenFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read token file: %v", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("Token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// setupToken asks for an API token or a personal access token, unless it's
+// in opts.TokenFile. A key to encrypt it is generated if there is none
+func (t *Todo) setupToken(opts InitOptions) error {
+	if t.PrivateKey == nil {
+		path, err := generatedKeyPath()
+		if err != nil {
+			return err
+		}
+		if t.PrivateKey, err = config.GenerateRSAKey(path); err != nil {
+			return err
+		}
+		fmt.Printf("Generated %s to encrypt your token\n\n", path)
+	}
+	if err := config.CheckKey(&t.PrivateKey.PublicKey); err != nil {
+		return err
+	}
+	t.JC = jira.NewClient(nil)
+	t.JC.HTTPClient.Timeout = t.Timeout
+	if err := t.askURL(opts.URL); err != nil {
+		return err
+	}
+	var token string
+	var err error
+	if opts.TokenFile != "" {
+		if token, err = readTokenFile(opts.TokenFile); err != nil {
+			return err
+		}
+	}
+	if opts.Auth == config.AuthBasic {
+		user, err := answer(opts.User, "Enter the email of your Jira account: ")
+		if err != nil {
+			return err
+		}
+		if token == "" {
+			fmt.Printf("\nCreate an API token at https://id.atlassian.com/manage-profile/security/api-tokens\n")
+			if token, err = prompt("Enter the API token: "); err != nil {
+				return err
+			}
+		}
+		t.JC.Auth = &jira.BasicAuth{User: user, Token: token}
+		return nil
+	}
+	if token == "" {
+		fmt.Printf("\nCreate a personal access token under Profile > Personal Access Tokens in Jira\n")
+		if token, err = prompt("Enter the personal access token: "); err != nil {
+			return err
+		}
+	}
+	t.JC.Auth = &jira.BearerAuth{Token: token}
 	return nil
 }
 
-func (t *Todo) chooseProject() (*jira.Project, error) {
-	var p jira.Project
-	for {
-		fmt.Printf("\nChoose which project you want Todo to use:\n\n")
-		projects, err := t.JC.ListProjects()
+// pickerSize is the number of projects listed at once when choosing one
+const pickerSize = 20
+
+// chooseProject returns the project with the given key, or lets the user
+// pick one of all the projects, searching by name or key when there are too
+// many to list
+func (t *Todo) chooseProject(key string) (*jira.Project, error) {
+	if key != "" {
+		p, err := t.JC.GetProjectContext(t.ctx(), key)
+		if jira.IsNotFound(err) {
+			return nil, fmt.Errorf("No Jira project with key '%s'", key)
+		}
 		if err != nil {
 			return nil, err
 		}
-		for index, project := range projects {
-			fmt.Println(fmt.Sprintf("%v) %s", index+1, project.Name))
+		fmt.Printf("Project '%s' chosen.\n", p.Name)
+		return p, nil
+	}
+	projects, err := t.JC.ListProjectsContext(t.ctx())
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("No Jira projects available")
+	}
+	shown := projects
+	for {
+		fmt.Printf("\nChoose which project you want Todo to use:\n\n")
+		n := len(shown)
+		if n > pickerSize {
+			n = pickerSize
+		}
+		for index, project := range shown[:n] {
+			fmt.Printf("%v) %s (%s)\n", index+1, project.Name, project.Key)
 		}
-		fmt.Printf("\nPick a project: ")
-		reader := bufio.NewReader(os.Stdin)
-		projectChoice, err := reader.ReadString('\n')
+		if len(shown) > n {
+			fmt.Printf("...and %d more\n", len(shown)-n)
+		}
+		fmt.Printf("\nPick a project, or search by name or key: ")
+		projectChoice, err := readLine(stdin)
 		if err != nil {
 			return nil, fmt.Errorf("Could not read input from picking a project ")
 		}
-		pInt, err := strconv.Atoi(strings.TrimSpace(projectChoice))
+		projectChoice = strings.TrimSpace(projectChoice)
+		pInt, err := strconv.Atoi(projectChoice)
 		if err != nil {
-			fmt.Printf("\nInvalid project choice! Only numbers between 1 and %v is available :%v\n",
-				len(projects), err)
+			matches := jira.MatchProjects(projects, projectChoice)
+			if len(matches) == 0 {
+				fmt.Printf("\nNo project matches '%s'\n", projectChoice)
+				continue
+			}
+			shown = matches
 			continue
 		}
-		if pInt <= 0 || pInt > len(projects) {
-			fmt.Printf("\nInvalid project choice! Only numbers between 1 and %v is available\n",
-				len(projects))
+		if pInt <= 0 || pInt > n {
+			fmt.Printf("\nInvalid project choice! Only numbers between 1 and %v is available\n", n)
 			continue
 		}
-		fmt.Printf("\nProject '%s' chosen.\n",
-			projects[pInt-1].Name)
-		p = projects[pInt-1]
-		break
+		p := shown[pInt-1]
+		fmt.Printf("\nProject '%s' chosen.\n", p.Name)
+		return &p, nil
 	}
-	return &p, nil
 }
 
-func (t *Todo) chooseDoneStatus(projectKey string) (*jira.Transition, *jira.Transition, string, error) {
-	var issueType string
-	var p, bl jira.Transition
-	for {
-		fmt.Printf("\nChoose which status you want to use when marking an issue as completed:\n\n")
-		searchJSON := []byte(fmt.Sprintf(
-			`{"jql":"project = %s", "startAt": 0, "maxResults": 1}`, projectKey))
-		si, err := t.JC.SearchIssues(searchJSON)
-		if err != nil || len(si) == 0 {
-			return nil, nil, "", err
-		}
-		issueType = si[0].Fields.IssueType.ID
-		transitions, err := t.JC.ListTransitions(si[0].ID)
-		if err != nil {
-			return nil, nil, "", err
+// chooseIssueType returns the ID of the issue type called name. Without a
+// name it is the type of the latest issue of the project, or else Task or the
+// first type that isn't a sub-task
+func (t *Todo) chooseIssueType(projectKey, name string) (string, error) {
+	types, err := t.JC.ListIssueTypesContext(t.ctx(), projectKey)
+	if err != nil {
+		return "", err
+	}
+	if name != "" {
+		var names []string
+		for _, it := range types {
+			if strings.EqualFold(it.Name, name) {
+				return it.ID, nil
+			}
+			names = append(names, it.Name)
 		}
-		for index, transition := range transitions {
-			if transition.Name == "Backlog" {
-				bl = transition
+		return "", fmt.Errorf("No issue type '%s'. Available are: %s", name, strings.Join(names, ", "))
+	}
+	searchJSON := []byte(fmt.Sprintf(
+		`{"jql":"project = %s ORDER BY created DESC", "startAt": 0, "maxResults": 1, "fields": ["issuetype"]}`, projectKey))
+	page, err := t.JC.SearchIssuesPageContext(t.ctx(), searchJSON)
+	if err != nil {
+		return "", err
+	}
+	if len(page.Values) > 0 {
+		latest := page.Values[0].Fields.IssueType.ID
+		for _, it := range types {
+			if it.ID == latest {
+				return it.ID, nil
 			}
-			fmt.Println(fmt.Sprintf("%v) %s", index+1, transition.Name))
 		}
-		fmt.Printf("\nPick a status: ")
-		reader := bufio.NewReader(os.Stdin)
-		projectChoice, err := reader.ReadString('\n')
-		if err != nil {
-			return nil, nil, "", fmt.Errorf("Could not read input from picking a project status")
+	}
+	var first *jira.IssueType
+	for i, it := range types {
+		if it.Subtask {
+			continue
+		}
+		if strings.EqualFold(it.Name, "Task") {
+			return it.ID, nil
+		}
+		if first == nil {
+			first = &types[i]
+		}
+	}
+	if first == nil {
+		return "", fmt.Errorf("You can't create issues in project %s", projectKey)
+	}
+	return first.ID, nil
+}
+
+// chooseStatuses returns the statuses completed and re-opened issues of the
+// issue type are moved to. The done status is asked for unless opts names
+// it. Without a re-open status in opts, any status of the new category will do
+func (t *Todo) chooseStatuses(projectKey, issueType string, opts InitOptions) (config.Status, config.Status, error) {
+	var done, reopen config.Status
+	all, err := t.JC.ListProjectStatusesContext(t.ctx(), projectKey)
+	if err != nil {
+		return done, reopen, err
+	}
+	statuses := statusesOf(all, issueType)
+	if len(statuses) == 0 {
+		return done, reopen, fmt.Errorf("Project %s has no statuses", projectKey)
+	}
+
+	reopen = config.Status{Category: jira.StatusNew}
+	if opts.ReopenStatus != "" {
+		s := findStatus(statuses, opts.ReopenStatus)
+		if s == nil {
+			return done, reopen, unknownStatus(opts.ReopenStatus, statuses)
 		}
-		pInt, err := strconv.Atoi(strings.TrimSpace(projectChoice))
+		reopen = statusOf(s)
+	}
+	if opts.DoneStatus != "" {
+		s := findStatus(statuses, opts.DoneStatus)
+		if s == nil {
+			return done, reopen, unknownStatus(opts.DoneStatus, statuses)
+		}
+		fmt.Printf("Status '%s' chosen.\n", s.Name)
+		return statusOf(s), reopen, nil
+	}
+
+	for {
+		fmt.Printf("\nChoose which status you want to use when marking an issue as completed:\n\n")
+		for index, status := range statuses {
+			fmt.Printf("%v) %s (%s)\n", index+1, status.Name, status.StatusCategory.Name)
+		}
+		fmt.Printf("\nPick a status: ")
+		statusChoice, err := readLine(stdin)
 		if err != nil {
-			fmt.Printf("\nInvalid status choice! Only numbers between 1 and %v is available :%v\n",
-				len(transitions), err)
-			continue
+			return done, reopen, fmt.Errorf("Could not read input from picking a project status")
 		}
-		if pInt <= 0 || pInt > len(transitions) {
+		pInt, err := strconv.Atoi(strings.TrimSpace(statusChoice))
+		if err != nil || pInt <= 0 || pInt > len(statuses) {
 			fmt.Printf("\nInvalid status choice! Only numbers between 1 and %v is available\n",
-				len(transitions))
+				len(statuses))
 			continue
 		}
-		fmt.Printf("\nStatus '%s' chosen.\n", transitions[pInt-1].Name)
-		p = transitions[pInt-1]
-		break
+		fmt.Printf("\nStatus '%s' chosen.\n", statuses[pInt-1].Name)
+		return statusOf(&statuses[pInt-1]), reopen, nil
+	}
+}
+
+// statusesOf returns the statuses of the issue type, or of every issue type
+// of the project if it has none of its own
+func statusesOf(all []jira.ProjectStatuses, issueType string) []jira.Status {
+	for _, ps := range all {
+		if ps.ID == issueType {
+			return ps.Statuses
+		}
+	}
+	var statuses []jira.Status
+	seen := map[string]bool{}
+	for _, ps := range all {
+		for _, s := range ps.Statuses {
+			if !seen[s.ID] {
+				seen[s.ID] = true
+				statuses = append(statuses, s)
+			}
+		}
+	}
+	return statuses
+}
+
+// findStatus returns the status with the given name, ignoring case
+func findStatus(statuses []jira.Status, name string) *jira.Status {
+	for i, s := range statuses {
+		if strings.EqualFold(s.Name, name) {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+func statusOf(s *jira.Status) config.Status {
+	return config.Status{ID: s.ID, Name: s.Name, Category: s.StatusCategory.Key}
+}
+
+func unknownStatus(name string, statuses []jira.Status) error {
+	names := make([]string, len(statuses))
+	for i, s := range statuses {
+		names[i] = s.Name
 	}
-	return &p, &bl, issueType, nil
+	return fmt.Errorf("No status '%s'. Available are: %s", name, strings.Join(names, ", "))
 }
@@ -17,7 +17,12 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"time"
+	"todo/internal/config"
+	"todo/internal/query"
+	"todo/internal/when"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
@@ -25,34 +30,135 @@ import (
 
 // listCmd represents the list command
 var listCmd = &cobra.Command{
-	Use:       "list",
-	Short:     "Lists all of your tasks",
-	Args:      cobra.OnlyValidArgs,
-	ValidArgs: []string{"open", "completed"},
+	Use:   "list [filter]",
+	Short: "Lists all of your tasks",
+	Long: `Lists all of your tasks, or the tasks matching a filter, e.g.
+
+  todo list open
+  todo list 'open and tag:backend and due<7d and text~"login"'
+  todo list @today
+
+Terms are joined with and, or and not and grouped with parentheses.
+
+Keywords:  open, done, overdue, linked, started, all
+Fields:    id, text, tag, key, pri, due, start, created, completed
+Operators: : (contains/is), = != < <= > >=, ~ (regular expression)
+
+Dates are the ones accepted by --due, e.g. today, fri or +7d. "none"
+matches tasks without the field, e.g. due:none. +backend is short for
+tag:backend and @name is the filter saved under name in todo.yaml:
+
+  filters:
+    backend: open and tag:backend`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		filter, err := cmd.Flags().GetString("filter")
-
 		if err != nil {
-			return fmt.Errorf("Invalid filter. Valid options are: [open, completed]")
+			return fmt.Errorf("Invalid filter")
+		}
+		var filters []string
+		for _, f := range append([]string{filter}, strings.Join(args, " ")) {
+			if strings.TrimSpace(f) != "" {
+				filters = append(filters, "("+f+")")
+			}
 		}
-		filter = strings.TrimSpace(strings.ToLower(filter))
-		if filter != "open" && filter != "completed" && filter != "" {
-			return fmt.Errorf("Invalid filter. Valid options are: [open, completed]")
+		opts := ListOptions{Filter: strings.Join(filters, " and ")}
+		if opts.All, err = cmd.Flags().GetBool("all"); err != nil {
+			return fmt.Errorf("Invalid value for all")
 		}
-		return t.List(filter)
+		priorities, _ := cmd.Flags().GetStringSlice("priority")
+		for _, p := range priorities {
+			name, err := config.ParsePriority(p)
+			if err != nil {
+				return err
+			}
+			opts.Priorities = append(opts.Priorities, name)
+		}
+		opts.Tags, _ = cmd.Flags().GetStringSlice("tag")
+		return t.List(opts)
 	},
 }
 
+// ListOptions selects which tasks List shows
+type ListOptions struct {
+	// Filter is a filter expression, see package query. Empty matches all
+	// tasks
+	Filter string
+	// All includes tasks whose start date is in the future
+	All bool
+	// Priorities shows only tasks with one of the priorities
+	Priorities []string
+	// Tags shows only tasks with all of the tags
+	Tags []string
+}
+
+// defaultFilters are saved filters that are available unless todo.yaml
+// saves another filter with the same name
+var defaultFilters = map[string]string{
+	"today": "open and due<=today",
+	"week":  "open and due<=+7d",
+}
+
+// match reports whether task should be listed
+func (o ListOptions) match(task *config.Task, filter query.Expr, now time.Time) bool {
+	if !o.All && task.Start.After(now) {
+		return false
+	}
+	if !filter.Match(task) {
+		return false
+	}
+	if len(o.Priorities) > 0 {
+		found := false
+		for _, p := range o.Priorities {
+			found = found || p == task.Priority
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, tag := range o.Tags {
+		if !task.HasTag(strings.TrimPrefix(tag, "+")) {
+			return false
+		}
+	}
+	return true
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
-	listCmd.Flags().StringP("filter", "f", "", "Filter list [open, completed]")
+	listCmd.Flags().StringP("filter", "f", "", "Filter expression, e.g. 'open and due<7d'")
+	listCmd.Flags().BoolP("all", "a", false, "Include tasks whose start date is in the future")
+	listCmd.Flags().StringSliceP("priority", "p", nil, "Only list tasks with one of the priorities")
+	listCmd.Flags().StringSliceP("tag", "t", nil, "Only list tasks with all of the tags")
+}
 
+// List tasks matching opts. Open tasks with a due date come first, soonest
+// first
+func (t *Todo) List(opts ListOptions) error {
+	tasks, err := t.Store.Tasks()
+	if err != nil {
+		return fmt.Errorf("Unable to read tasks: %v", err)
+	}
+	now := time.Now()
+	filter, err := query.Parse(opts.Filter, now, t.filters())
+	if err != nil {
+		return err
+	}
+	var matching []*config.Task
+	for _, task := range sortByDue(tasks) {
+		if opts.match(task, filter, now) {
+			matching = append(matching, task)
+		}
+	}
+	return t.printTasks(matching)
 }
 
-// List tasks
-func (t *Todo) List(filter string) error {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"#", "Done", "Task", "Created", "Completed", "URL"})
+// printTable prints tasks as a table. Overdue tasks are red and tasks due
+// today yellow when printing to a terminal
+func (t *Todo) printTable(tasks []*config.Task) error {
+	now := time.Now()
+	out := t.stdout()
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"ID", "Done", "Pri", "Task", "Tags", "Created", "Due", "Completed", "URL"})
 	table.SetBorder(true)
 	table.SetHeaderColor(
 		tablewriter.Colors{tablewriter.Bold},
@@ -61,14 +167,13 @@ func (t *Todo) List(filter string) error {
 		tablewriter.Colors{tablewriter.Bold},
 		tablewriter.Colors{tablewriter.Bold},
 		tablewriter.Colors{tablewriter.Bold},
+		tablewriter.Colors{tablewriter.Bold},
+		tablewriter.Colors{tablewriter.Bold},
+		tablewriter.Colors{tablewriter.Bold},
 	)
-	for index, task := range t.Config.Tasks {
-		switch {
-		case filter == "open" && task.Done:
-			continue
-		case filter == "completed" && !task.Done:
-			continue
-		}
+	f, ok := out.(*os.File)
+	color := ok && isTerminal(f)
+	for _, task := range tasks {
 		var done, completed string
 		taskName := task.Text
 		if len(taskName) >= 20 {
@@ -80,21 +185,89 @@ func (t *Todo) List(filter string) error {
 		if task.Completed.Unix() > 0 {
 			completed = task.Completed.Format("2006-01-02 15:04:05")
 		}
-		var jiraURL string
-		if task.JiraKey != "" {
-			jiraURL = fmt.Sprintf("%s/browse/%s", t.Config.Jira.URL, task.JiraKey)
-		}
 		row := []string{
 
-			fmt.Sprintf("%d", index+1),
+			fmt.Sprintf("%d", task.ID),
 			done,
+			task.Priority,
 			taskName,
+			strings.Join(task.Tags, " "),
 			task.Created.Format("2006-01-02 15:04:05"),
+			formatDue(task.Due),
 			completed,
-			jiraURL,
+			t.issueURL(task),
+		}
+		if color && !task.Done {
+			switch {
+			case overdue(task, now):
+				row = colorRow(row, tablewriter.FgRedColor)
+			case dueToday(task, now):
+				row = colorRow(row, tablewriter.FgYellowColor)
+			}
 		}
 		table.Append(row)
 	}
 	table.Render()
 	return nil
 }
+
+// filters returns the saved filters by name
+func (t *Todo) filters() map[string]string {
+	filters := map[string]string{}
+	for name, f := range defaultFilters {
+		filters[name] = f
+	}
+	for name, f := range t.Config.Filters {
+		filters[strings.ToLower(name)] = f
+	}
+	return filters
+}
+
+// sortByDue returns tasks with the open tasks that have a due date first,
+// ordered by due date. The order of the other tasks is kept
+func sortByDue(tasks []*config.Task) []*config.Task {
+	sorted := append([]*config.Task{}, tasks...)
+	hasDue := func(task *config.Task) bool { return !task.Done && !task.Due.IsZero() }
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if hasDue(a) && hasDue(b) {
+			return a.Due.Before(b.Due)
+		}
+		return hasDue(a) && !hasDue(b)
+	})
+	return sorted
+}
+
+func overdue(task *config.Task, now time.Time) bool {
+	return !task.Due.IsZero() && task.Due.Before(now)
+}
+
+func dueToday(task *config.Task, now time.Time) bool {
+	return !task.Due.IsZero() && when.StartOfDay(task.Due).Equal(when.StartOfDay(now))
+}
+
+// formatDue leaves out the time of due dates that last the whole day
+func formatDue(d time.Time) string {
+	switch {
+	case d.IsZero():
+		return ""
+	case when.IsEndOfDay(d):
+		return d.Format("2006-01-02")
+	}
+	return d.Format("2006-01-02 15:04")
+}
+
+func colorRow(row []string, color int) []string {
+	for i, cell := range row {
+		if cell != "" {
+			row[i] = fmt.Sprintf("\033[%dm%s\033[0m", color, cell)
+		}
+	}
+	return row
+}
+
+// isTerminal reports whether f is a terminal rather than a file or a pipe
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,115 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"todo/internal/config"
+	"todo/internal/outbox"
+
+	"github.com/spf13/cobra"
+)
+
+// noteCmd represents the note command
+var noteCmd = &cobra.Command{
+	Use:   "note <id> <text>",
+	Args:  cobra.MinimumNArgs(2),
+	Short: "Adds a note to the supplied task",
+	Long: `Adds a timestamped note to a task. Notes on tasks linked to Jira are added to
+the issue as comments too. 'todo show' lists the notes together with the
+comments made in Jira`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.Note(args[:1], strings.Join(args[1:], " "))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(noteCmd)
+}
+
+// Note adds a note with the supplied text to a task
+func (t *Todo) Note(args []string, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("Note can't be empty")
+	}
+	task, err := t.findTask(args)
+	if err != nil {
+		return err
+	}
+	t.status("Adding note to task: '%s'", task.Text)
+	note := config.Note{Time: time.Now(), Text: text}
+	c := change{
+		task: task,
+		local: func() error {
+			task.Notes = append(task.Notes, note)
+			return t.Store.Update(task)
+		},
+	}
+	if task.JiraID != "" {
+		c.remote = func() error {
+			var err error
+			note.CommentID, err = t.addComment(task, note.Text)
+			return err
+		}
+		c.rollback = func() error { return t.deleteComment(task, note.CommentID) }
+		c.queue = func() []*outbox.Op { return commentOps(task, note) }
+		c.done = func() string { return fmt.Sprintf("The note was added to Jira issue %s", task.JiraKey) }
+		c.repair = fmt.Sprintf(
+			"Delete the comment from %s and run 'todo note %d' again.", task.JiraKey, task.ID)
+	}
+	return t.apply(c)
+}
+
+// addComment adds text as a comment to the issue of task and returns the ID
+// of the comment
+func (t *Todo) addComment(task *config.Task, text string) (string, error) {
+	jc, _, err := t.jiraFor(task)
+	if err != nil {
+		return "", err
+	}
+	comment, err := jc.AddCommentContext(t.ctx(), task.JiraID, text)
+	if err != nil {
+		return "", fmt.Errorf("Unable to add Jira comment: %w", err)
+	}
+	return comment.ID, nil
+}
+
+// deleteComment deletes a comment from the issue of task
+func (t *Todo) deleteComment(task *config.Task, commentID string) error {
+	jc, _, err := t.jiraFor(task)
+	if err != nil {
+		return err
+	}
+	if err := jc.DeleteCommentContext(t.ctx(), task.JiraID, commentID); err != nil {
+		return fmt.Errorf("Unable to delete Jira comment: %w", err)
+	}
+	return nil
+}
+
+// noteItems are the notes of task, which are added to its issue as comments
+func (t *Todo) noteItems(task *config.Task) items {
+	return items{
+		len:     len(task.Notes),
+		pending: func(i int) bool { return task.Notes[i].CommentID == "" },
+		post: func(i int) (err error) {
+			task.Notes[i].CommentID, err = t.addComment(task, task.Notes[i].Text)
+			return err
+		},
+		posted: "The note was added to",
+	}
+}
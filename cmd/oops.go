@@ -17,17 +17,19 @@ package cmd
 import (
 	"fmt"
 	"time"
-	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/outbox"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // oopsCmd represents the oops command
 var oopsCmd = &cobra.Command{
-	Use:   "oops",
+	Use:   "oops <id>",
 	Args:  cobra.ExactArgs(1),
 	Short: "Re-opens an accidentally completed task",
+	Long: `Re-opens a completed task. The task can be given by its ID, its Jira key
+or the beginning of its text as long as that matches only one task`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return t.Oops(args)
 	},
@@ -39,25 +41,30 @@ func init() {
 
 // Oops will re-open a closed issue
 func (t *Todo) Oops(args []string) error {
-	var i int
-	var err error
-	if i, err = t.verifyIndex(args); err != nil {
+	task, err := t.findTask(args)
+	if err != nil {
 		return err
 	}
-	task := t.Config.Tasks[i]
 	if task.Done == false {
 		return fmt.Errorf("Task '%s' is not completed", task.Text)
 	}
-	fmt.Printf("Re-opening task: '%s'\n", task.Text)
+	t.status("Re-opening task: '%s'", task.Text)
+	c := change{
+		task:  task,
+		entry: &journal.Entry{Op: "oops", Before: task.Clone()},
+		local: func() error {
+			task.Done = false
+			task.Completed = time.Time{}
+			return t.Store.Update(task)
+		},
+	}
 	if task.JiraID != "" {
-		err = t.JC.ChangeIssueStatus(task.JiraID, t.Config.Jira.Project.BacklogID, "Re-opened by Todo")
-		if err != nil {
-			return fmt.Errorf("Unable to change Jira status: %v", err)
-		}
+		c.remote = func() error { return t.transition(task, false) }
+		c.rollback = func() error { return t.transition(task, true) }
+		c.queue = func() []*outbox.Op { return transitionOps(task, false) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was re-opened", task.JiraKey) }
+		c.repair = fmt.Sprintf(
+			"Close %s in Jira and run 'todo oops %d' again.", task.JiraKey, task.ID)
 	}
-	task.Done = false
-	var tt time.Time
-	task.Completed = tt
-	config.Write(viper.ConfigFileUsed(), &t.Config)
-	return nil
+	return t.apply(c)
 }
@@ -0,0 +1,197 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"todo/internal/config"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// OutputFormats are the formats accepted by --output
+var OutputFormats = []string{"table", "json", "yaml", "csv", "tsv", "template"}
+
+// TaskOutput is a task as printed by --output, with the Jira URL added
+type TaskOutput struct {
+	config.Task `yaml:",inline"`
+	URL         string `yaml:"url,omitempty" json:"url,omitempty"`
+}
+
+// csvHeader are the columns of the csv and tsv formats
+var csvHeader = []string{
+	"id", "done", "priority", "text", "tags", "created", "start", "due", "completed", "jira_key", "url",
+}
+
+// checkOutput validates --output and --template before a command changes
+// anything
+func (t *Todo) checkOutput() error {
+	switch t.Output {
+	case "", "table", "json", "yaml", "csv", "tsv":
+		return nil
+	case "template":
+		_, err := t.template()
+		return err
+	}
+	return fmt.Errorf("Invalid output format '%s'. Valid options are: [%s]",
+		t.Output, strings.Join(OutputFormats, ", "))
+}
+
+func (t *Todo) template() (*template.Template, error) {
+	if t.Template == "" {
+		return nil, fmt.Errorf("--output template requires --template")
+	}
+	tmpl, err := template.New("output").Parse(t.Template)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// machineOutput reports whether output is meant for other programs, in
+// which case messages for the user go to stderr
+func (t *Todo) machineOutput() bool {
+	return t.Output != "" && t.Output != "table"
+}
+
+func (t *Todo) stdout() io.Writer {
+	if t.Out != nil {
+		return t.Out
+	}
+	return os.Stdout
+}
+
+// status prints a message for the user. It goes to stderr unless the
+// output is a table so that it doesn't end up in parsed output
+func (t *Todo) status(format string, args ...interface{}) {
+	w := t.stdout()
+	if t.machineOutput() {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, format+"\n", args...)
+}
+
+// printTask prints a task changed by a command. Tables only get the
+// status message the command already printed
+func (t *Todo) printTask(task *config.Task) error {
+	if !t.machineOutput() || task == nil {
+		return nil
+	}
+	if t.Output == "json" || t.Output == "yaml" {
+		return t.encode(t.taskOutput(task))
+	}
+	return t.printTasks([]*config.Task{task})
+}
+
+// printTasks prints tasks in the format chosen with --output
+func (t *Todo) printTasks(tasks []*config.Task) error {
+	if err := t.checkOutput(); err != nil {
+		return err
+	}
+	out := make([]TaskOutput, 0, len(tasks))
+	for _, task := range tasks {
+		out = append(out, t.taskOutput(task))
+	}
+	w := t.stdout()
+	switch t.Output {
+	case "json", "yaml":
+		return t.encode(out)
+	case "csv", "tsv":
+		cw := csv.NewWriter(w)
+		if t.Output == "tsv" {
+			cw.Comma = '\t'
+		}
+		cw.Write(csvHeader)
+		for _, task := range out {
+			cw.Write(csvRow(task))
+		}
+		cw.Flush()
+		return cw.Error()
+	case "template":
+		tmpl, err := t.template()
+		if err != nil {
+			return err
+		}
+		for _, task := range out {
+			if err := tmpl.Execute(w, task); err != nil {
+				return fmt.Errorf("Unable to execute template: %v", err)
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	}
+	return t.printTable(tasks)
+}
+
+func (t *Todo) encode(v interface{}) error {
+	w := t.stdout()
+	if t.Output == "yaml" {
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (t *Todo) taskOutput(task *config.Task) TaskOutput {
+	return TaskOutput{Task: *task.Clone(), URL: t.issueURL(task)}
+}
+
+// issueURL returns the browse URL of the task's Jira issue, if any
+func (t *Todo) issueURL(task *config.Task) string {
+	if task.JiraKey == "" || t.Config == nil {
+		return ""
+	}
+	j, err := t.Config.JiraProfile(task.Profile)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/browse/%s", j.URL, task.JiraKey)
+}
+
+func csvRow(task TaskOutput) []string {
+	date := func(d time.Time) string {
+		if d.IsZero() {
+			return ""
+		}
+		return d.Format(time.RFC3339)
+	}
+	return []string{
+		strconv.Itoa(task.ID),
+		strconv.FormatBool(task.Done),
+		task.Priority,
+		task.Text,
+		strings.Join(task.Tags, " "),
+		date(task.Created),
+		date(task.Start),
+		date(task.Due),
+		date(task.Completed),
+		task.JiraKey,
+		task.URL,
+	}
+}
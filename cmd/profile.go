@@ -0,0 +1,189 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"todo/internal/config"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manages the Jira profiles",
+	Long: `A profile is a Jira installation, the credentials for it and the project todo
+uses there. The profile set up by 'todo init' is called default. Every command
+uses the profile chosen with 'todo profile use', or the one given with
+--profile.
+
+Tasks remember the profile their Jira issue belongs to, so they are completed
+and deleted in the right Jira whichever profile is in use.`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Args:  cobra.NoArgs,
+	Short: "Lists the profiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.ListProfiles()
+	},
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Makes a profile the one used by default",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.UseProfile(args[0])
+	},
+}
+
+var profileAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Sets up a new profile",
+	Long: `Sets up a new profile the way 'todo init' sets up the default one, and takes
+the same flags.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.AddProfile(args[0], initOptions(cmd))
+	},
+}
+
+var profileRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Removes a profile no task is linked to",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.RemoveProfile(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd, profileUseCmd, profileAddCmd, profileRemoveCmd)
+	addInitFlags(profileAddCmd)
+}
+
+// ProfileOutput is a profile as listed by profile list
+type ProfileOutput struct {
+	Name    string `json:"name" yaml:"name"`
+	URL     string `json:"url" yaml:"url"`
+	Project string `json:"project" yaml:"project"`
+	Auth    string `json:"auth" yaml:"auth"`
+	Default bool   `json:"default" yaml:"default"`
+}
+
+// ListProfiles prints the profiles
+func (t *Todo) ListProfiles() error {
+	profiles := []ProfileOutput{}
+	for _, name := range t.Config.ProfileNames() {
+		j, err := t.Config.JiraProfile(name)
+		if err != nil {
+			return err
+		}
+		auth := j.Auth
+		if auth == "" {
+			auth = config.AuthOAuth1
+		}
+		profiles = append(profiles, ProfileOutput{
+			Name:    name,
+			URL:     j.URL,
+			Project: j.Project.Key,
+			Auth:    auth,
+			Default: config.ProfileName(name) == t.Config.Profile,
+		})
+	}
+	switch t.Output {
+	case "json", "yaml":
+		return t.encode(profiles)
+	}
+	table := tablewriter.NewWriter(t.stdout())
+	table.SetHeader([]string{"", "Profile", "URL", "Project", "Auth"})
+	table.SetBorder(true)
+	for _, p := range profiles {
+		mark := ""
+		if p.Default {
+			mark = "*"
+		}
+		table.Append([]string{mark, p.Name, p.URL, p.Project, p.Auth})
+	}
+	table.Render()
+	return nil
+}
+
+// UseProfile makes name the profile used when --profile isn't given
+func (t *Todo) UseProfile(name string) error {
+	if _, err := t.Config.JiraProfile(name); err != nil {
+		return err
+	}
+	t.Config.Profile = config.ProfileName(name)
+	if err := t.ConfigFile.Write(t.Config); err != nil {
+		return fmt.Errorf("Unable to save config: %v", err)
+	}
+	t.status("Using profile '%s'", name)
+	return nil
+}
+
+// AddProfile sets up the profile name as opts says
+func (t *Todo) AddProfile(name string, opts InitOptions) error {
+	if _, err := t.Config.JiraProfile(name); err == nil && !(config.ProfileName(name) == "" && t.Config.Jira.URL == "") {
+		return fmt.Errorf("Profile '%s' already exists. Run 'todo --profile %s init' to set it up again", name, name)
+	}
+	t.Profile = config.ProfileName(name)
+	return t.SetupJira(opts)
+}
+
+// RemoveProfile removes the profile name. The default profile, and profiles
+// tasks are linked to, are kept
+func (t *Todo) RemoveProfile(name string) error {
+	if config.ProfileName(name) == "" {
+		return fmt.Errorf("The default profile can't be removed")
+	}
+	if _, err := t.Config.JiraProfile(name); err != nil {
+		return err
+	}
+	tasks, err := t.Store.Tasks()
+	if err != nil {
+		return fmt.Errorf("Unable to read tasks: %v", err)
+	}
+	linked := 0
+	for _, task := range tasks {
+		if task.Profile == name {
+			linked++
+		}
+	}
+	if linked > 0 {
+		return fmt.Errorf("%d tasks are linked to issues in profile '%s'. Delete them, or take them offline with 'todo toggle', first", linked, name)
+	}
+	if t.Outbox != nil {
+		for _, op := range t.Outbox.Ops() {
+			if op.Profile == name {
+				return fmt.Errorf("Changes for profile '%s' are queued. Run 'todo flush' first", name)
+			}
+		}
+	}
+	delete(t.Config.Profiles, name)
+	if t.Config.Profile == name {
+		t.Config.Profile = ""
+	}
+	if err := t.ConfigFile.Write(t.Config); err != nil {
+		return fmt.Errorf("Unable to save config: %v", err)
+	}
+	t.status("Profile '%s' removed", name)
+	return nil
+}
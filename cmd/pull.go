@@ -0,0 +1,154 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"jira"
+	"strings"
+	"time"
+	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/when"
+
+	"github.com/spf13/cobra"
+)
+
+// pullPageSize is the number of issues fetched per request
+const pullPageSize = 100
+
+// pullCmd represents the pull command
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Args:  cobra.NoArgs,
+	Short: "Adds Jira issues assigned to you as tasks",
+	Long: `Adds a linked task for every Jira issue found by the JQL query that is not on
+your todo list yet. Running it again only adds the new issues.
+
+The default query finds the unresolved issues assigned to you in the configured
+project:
+
+  project = PRJ AND assignee = currentUser() AND resolution = Unresolved`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jql, _ := cmd.Flags().GetString("jql")
+		return t.Pull(jql)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+	pullCmd.Flags().String("jql", "", "JQL query selecting the issues to add")
+}
+
+// Pull adds the issues found by jql that are not linked to a task yet. An
+// empty jql finds the unresolved issues assigned to the user
+func (t *Todo) Pull(jql string) error {
+	if t.JC == nil || t.JC.BaseURL == "" {
+		return fmt.Errorf("Could not read configuration. Run 'todo init'")
+	}
+	if strings.TrimSpace(jql) == "" {
+		project := t.jiraConfig().Project.Key
+		if project == "" {
+			project = t.jiraConfig().Project.ID
+		}
+		jql = fmt.Sprintf("project = %s AND assignee = currentUser() AND resolution = Unresolved", project)
+	}
+	search, err := json.Marshal(map[string]interface{}{
+		"jql":        jql,
+		"startAt":    0,
+		"maxResults": pullPageSize,
+		"fields":     []string{"summary", "status", "duedate", "labels", "priority"},
+	})
+	if err != nil {
+		return err
+	}
+	issues, err := t.JC.SearchIssuesContext(t.ctx(), search)
+	if err != nil {
+		return fmt.Errorf("Unable to search Jira issues: %w", err)
+	}
+	tasks, err := t.Store.Tasks()
+	if err != nil {
+		return fmt.Errorf("Unable to read tasks: %v", err)
+	}
+	// Issues of other profiles may have the same IDs and keys
+	tracked := map[string]bool{}
+	for _, task := range tasks {
+		if task.Profile != t.Profile {
+			continue
+		}
+		tracked[task.JiraID] = true
+		tracked[strings.ToUpper(task.JiraKey)] = true
+	}
+	added := 0
+	for i := range issues {
+		issue := &issues[i]
+		if tracked[issue.ID] || tracked[strings.ToUpper(issue.Key)] {
+			continue
+		}
+		task := taskFromIssue(issue)
+		task.Profile = t.Profile
+		err := t.apply(change{
+			task:  task,
+			local: func() error { return t.Store.Add(task) },
+			entry: &journal.Entry{Op: "pull"},
+		})
+		if err != nil {
+			return err
+		}
+		if t.Synced != nil {
+			if err := t.Synced.Set(task); err != nil {
+				t.status("Unable to save the synced state of task %d: %v", task.ID, err)
+			}
+		}
+		tracked[issue.ID] = true
+		added++
+		t.status("Added %s: '%s'", task.JiraKey, task.Text)
+	}
+	t.status("Found %d issues, %d added, %d already on your todo list", len(issues), added, len(issues)-added)
+	return nil
+}
+
+// taskFromIssue returns a new task linked to issue
+func taskFromIssue(issue *jira.Issue) *config.Task {
+	now := time.Now()
+	task := &config.Task{
+		Text:    issueText(issue),
+		JiraID:  issue.ID,
+		JiraKey: issue.Key,
+		Project: projectKey(issue.Key),
+		Created: now,
+	}
+	setDone(task, issue.Done())
+	if d, err := time.ParseInLocation(jira.DateFormat, issue.Fields.DueDate, time.Local); err == nil {
+		task.Due = when.EndOfDay(d)
+	}
+	task.Tags = addTags(nil, issue.Fields.Labels...)
+	if issue.Fields.Priority != nil {
+		// Only the default Jira priorities map to task priorities
+		if p, err := config.ParsePriority(issue.Fields.Priority.Name); err == nil {
+			task.Priority = p
+		}
+	}
+	return task
+}
+
+// projectKey returns the project part of an issue key like PRJ-12
+func projectKey(issueKey string) string {
+	if i := strings.LastIndex(issueKey, "-"); i > 0 {
+		return issueKey[:i]
+	}
+	return ""
+}
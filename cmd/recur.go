@@ -0,0 +1,218 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/outbox"
+	"todo/internal/recur"
+	"todo/internal/when"
+
+	"github.com/spf13/cobra"
+)
+
+// setRecurrence sets the recurrence of task from the --every and --reopen
+// flags of cmd, if they were given
+func setRecurrence(cmd *cobra.Command, task *config.Task) error {
+	if cmd.Flags().Changed("every") {
+		s, _ := cmd.Flags().GetString("every")
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "", "none":
+			task.Recur = nil
+		default:
+			reopen := task.Recur != nil && task.Recur.Reopen
+			task.Recur = &config.Recurrence{Rule: s, Reopen: reopen}
+		}
+	}
+	if cmd.Flags().Changed("reopen") {
+		if task.Recur == nil {
+			return fmt.Errorf("Only recurring tasks can be re-opened, use --every as well")
+		}
+		task.Recur.Reopen, _ = cmd.Flags().GetBool("reopen")
+	}
+	return nil
+}
+
+// scheduleRecurrence checks the rule of a recurring task and stores it as
+// an RRULE. A recurring task without a due date is due at its first
+// occurrence, and a monthly or yearly rule without a day repeats on the day
+// it is due
+func scheduleRecurrence(task *config.Task, now time.Time) error {
+	if task.Recur == nil {
+		return nil
+	}
+	rule, err := recur.Parse(task.Recur.Rule)
+	if err != nil {
+		return fmt.Errorf("Invalid recurrence '%s': %v", task.Recur.Rule, err)
+	}
+	if task.Due.IsZero() {
+		task.Due = when.EndOfDay(rule.First(now))
+	}
+	// Keeps the day when an occurrence falls in a shorter month
+	switch {
+	case rule.Freq == recur.Monthly && rule.ByMonthDay == 0:
+		rule.ByMonthDay = task.Due.Day()
+	case rule.Freq == recur.Yearly && rule.ByMonth == 0:
+		rule.ByMonth, rule.ByMonthDay = task.Due.Month(), task.Due.Day()
+	}
+	task.Recur.Rule = rule.String()
+	return nil
+}
+
+// reschedule moves the due and start dates of task to the occurrence of
+// rule after the one completed at now. Occurrences that have already
+// passed are skipped
+func reschedule(task *config.Task, rule *recur.Rule, now time.Time) {
+	if task.Due.IsZero() {
+		task.Due = when.EndOfDay(rule.Next(now))
+		return
+	}
+	next := rule.Next(task.Due)
+	for next.Before(when.StartOfDay(now)) {
+		next = rule.Next(next)
+	}
+	if !task.Start.IsZero() {
+		days := when.StartOfDay(next).Sub(when.StartOfDay(task.Due)).Hours() / 24
+		task.Start = task.Start.AddDate(0, 0, int(math.Round(days)))
+	}
+	task.Due = next
+}
+
+// completeOccurrence completes the current occurrence of a recurring task
+func (t *Todo) completeOccurrence(task *config.Task) error {
+	rule, err := recur.Parse(task.Recur.Rule)
+	if err != nil {
+		return fmt.Errorf("Invalid recurrence of task '%s': %v. Fix it with 'todo edit %d --every'",
+			task.Text, err, task.ID)
+	}
+	now := time.Now()
+	if task.Recur.Reopen {
+		return t.reopenOccurrence(task, rule, now)
+	}
+	// The completion and the next occurrence are undone together
+	c := t.completion(task)
+	entry := c.entry
+	c.entry = nil
+	if err := t.apply(c); err != nil {
+		return err
+	}
+	next, err := t.addOccurrence(task, rule, now)
+	if err == nil {
+		entry.Also = []*journal.Entry{{Op: "add", After: next.Clone()}}
+		// The next occurrence recurs instead, so an oops and another
+		// complete don't add it twice
+		task.Recur = nil
+		if serr := t.Store.Update(task); serr != nil {
+			t.status("Unable to save task %d, it still recurs: %v", task.ID, serr)
+		}
+	}
+	t.record(change{task: task, entry: entry})
+	return err
+}
+
+// reopenOccurrence keeps task, and its Jira issue, for the next occurrence.
+// The issue is closed and re-opened, so Jira has the history of every
+// occurrence
+func (t *Todo) reopenOccurrence(task *config.Task, rule *recur.Rule, now time.Time) error {
+	before := task.Clone()
+	next := task.Clone()
+	next.Completed = now
+	reschedule(next, rule, now)
+	c := change{
+		task:  task,
+		entry: &journal.Entry{Op: "complete", Before: before},
+		local: func() error {
+			task.Completed, task.Due, task.Start = next.Completed, next.Due, next.Start
+			return t.Store.Update(task)
+		},
+	}
+	if task.JiraID != "" {
+		c.remote = func() error {
+			if err := t.transition(task, true); err != nil {
+				return err
+			}
+			if err := t.transition(task, false); err != nil {
+				return err
+			}
+			return t.updateJira(before, next)
+		}
+		c.rollback = func() error { return t.updateJira(next, before) }
+		c.queue = func() []*outbox.Op {
+			ops := append(transitionOps(task, true), transitionOps(task, false)...)
+			return append(ops, updateOps(before, task)...)
+		}
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was closed and re-opened", task.JiraKey) }
+		c.repair = fmt.Sprintf("Set the due date of %s in Jira to %s.", task.JiraKey, jiraDate(next.Due))
+	}
+	if err := t.apply(c); err != nil {
+		return err
+	}
+	t.status("Task '%s' is due again %s", task.Text, formatDue(task.Due))
+	return nil
+}
+
+// addOccurrence adds the occurrence of a recurring task after the one in
+// task, completed at now, and returns it. It gets a new Jira issue if task
+// is linked
+func (t *Todo) addOccurrence(task *config.Task, rule *recur.Rule, now time.Time) (*config.Task, error) {
+	next := &config.Task{
+		Text:     task.Text,
+		Created:  now,
+		Due:      task.Due,
+		Start:    task.Start,
+		Priority: task.Priority,
+		Tags:     append([]string(nil), task.Tags...),
+		Profile:  task.Profile,
+		Project:  task.Project,
+		Recur:    task.Clone().Recur,
+	}
+	reschedule(next, rule, now)
+	c := change{
+		task:  next,
+		local: func() error { return t.Store.Add(next) },
+	}
+	if task.JiraID != "" {
+		c.remote = func() error { return t.createJira(next) }
+		c.rollback = func() error { return t.deleteIssue(next) }
+		c.queue = func() []*outbox.Op { return createOps(next) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was created", next.JiraKey) }
+		c.repair = "Delete the Jira issue and add the task again."
+	}
+	if err := t.apply(c); err != nil {
+		return nil, err
+	}
+	t.status("Next occurrence added, due %s", formatDue(next.Due))
+	return next, nil
+}
+
+// recurSummary describes the recurrence of a task for 'todo show'
+func recurSummary(r *config.Recurrence) string {
+	if r == nil {
+		return ""
+	}
+	rule, err := recur.Parse(r.Rule)
+	if err != nil {
+		return fmt.Sprintf("%s (invalid: %v)", r.Rule, err)
+	}
+	if r.Reopen {
+		return rule.Describe() + ", re-opening the same Jira issue"
+	}
+	return rule.Describe()
+}
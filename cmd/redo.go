@@ -0,0 +1,51 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// redoCmd represents the redo command
+var redoCmd = &cobra.Command{
+	Use:   "redo",
+	Args:  cobra.NoArgs,
+	Short: "Redoes the last change undone with 'todo undo'",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.Redo()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(redoCmd)
+}
+
+// Redo the last change reverted by Undo
+func (t *Todo) Redo() error {
+	if t.Journal == nil {
+		return fmt.Errorf("No journal available, nothing to redo")
+	}
+	e, err := t.Journal.Redoable()
+	if err != nil {
+		return fmt.Errorf("Unable to read journal: %v", err)
+	}
+	if e == nil {
+		return fmt.Errorf("Nothing to redo")
+	}
+	t.status("Redoing %s of task %d", e.Op, e.TaskID())
+	return t.revert(e, false)
+}
@@ -0,0 +1,196 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"todo/internal/when"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Reports on your tasks",
+}
+
+// reportTimeCmd represents the report time command
+var reportTimeCmd = &cobra.Command{
+	Use:   "time",
+	Args:  cobra.NoArgs,
+	Short: "Sums the time spent per task, tag and day",
+	Long: `Sums the time recorded with 'todo start', 'todo stop' and 'todo log' per task,
+per tag and per day. Time spent on a task with several tags counts for every
+tag. A running timer counts up to now.
+
+--since and --until accept dates like 'todo edit'. Weekday names given to
+--since mean the last one, e.g. "mon" is the beginning of this week. A date
+given to --until without a time of day includes that whole day`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		s, _ := cmd.Flags().GetString("since")
+		since, err := when.Since(s, now)
+		if err != nil {
+			return err
+		}
+		until := now
+		if u, _ := cmd.Flags().GetString("until"); u != "" {
+			if until, err = when.Until(u, now); err != nil {
+				return err
+			}
+		}
+		return t.ReportTime(since, until)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportTimeCmd)
+	reportTimeCmd.Flags().String("since", "mon", "Beginning of the report")
+	reportTimeCmd.Flags().String("until", "", "End of the report, now by default")
+}
+
+// TimeSpent is the time spent on a task, with a tag or on a day
+type TimeSpent struct {
+	// Name is the text of the task, the tag or the day as 2006-01-02
+	Name    string  `yaml:"name" json:"name"`
+	Task    int     `yaml:"task,omitempty" json:"task,omitempty"`
+	JiraKey string  `yaml:"jira_key,omitempty" json:"jira_key,omitempty"`
+	Hours   float64 `yaml:"hours" json:"hours"`
+}
+
+// TimeReport is the time spent between Since and Until
+type TimeReport struct {
+	Since time.Time   `yaml:"since" json:"since"`
+	Until time.Time   `yaml:"until" json:"until"`
+	Tasks []TimeSpent `yaml:"tasks" json:"tasks"`
+	Tags  []TimeSpent `yaml:"tags" json:"tags"`
+	Days  []TimeSpent `yaml:"days" json:"days"`
+	Hours float64     `yaml:"hours" json:"hours"`
+}
+
+// untagged is the tag time spent on tasks without tags is reported under
+const untagged = "(untagged)"
+
+// ReportTime prints the time spent between since and until per task, tag
+// and day
+func (t *Todo) ReportTime(since, until time.Time) error {
+	if err := t.checkOutput(); err != nil {
+		return err
+	}
+	if !until.After(since) {
+		return fmt.Errorf("The report has to end after %s", since.Format("2006-01-02 15:04"))
+	}
+	tasks, err := t.Store.Tasks()
+	if err != nil {
+		return fmt.Errorf("Unable to read tasks: %v", err)
+	}
+	now := time.Now()
+	report := TimeReport{Since: since, Until: until, Tasks: []TimeSpent{}}
+	byTag := map[string]time.Duration{}
+	byDay := map[string]time.Duration{}
+	var total time.Duration
+	for _, task := range tasks {
+		var spent time.Duration
+		for _, e := range task.TimeEntries {
+			start, end := e.Start, e.End
+			if e.Running() {
+				end = now
+			}
+			if start.Before(since) {
+				start = since
+			}
+			if end.After(until) {
+				end = until
+			}
+			// Time past midnight counts for the next day
+			for start.Before(end) {
+				next := when.StartOfDay(start).AddDate(0, 0, 1)
+				if next.After(end) {
+					next = end
+				}
+				byDay[start.Format("2006-01-02")] += next.Sub(start)
+				spent += next.Sub(start)
+				start = next
+			}
+		}
+		if spent == 0 {
+			continue
+		}
+		total += spent
+		report.Tasks = append(report.Tasks, TimeSpent{
+			Name: task.Text, Task: task.ID, JiraKey: task.JiraKey, Hours: hours(spent),
+		})
+		if len(task.Tags) == 0 {
+			byTag[untagged] += spent
+		}
+		for _, tag := range task.Tags {
+			byTag[tag] += spent
+		}
+	}
+	report.Tags = sortedSpent(byTag)
+	report.Days = sortedSpent(byDay)
+	report.Hours = hours(total)
+
+	switch t.Output {
+	case "json", "yaml":
+		return t.encode(report)
+	}
+	if total == 0 {
+		t.status("No time recorded since %s", since.Format("2006-01-02 15:04"))
+		return nil
+	}
+	t.printSpent([]string{"#", "Task", "Issue", "Hours"}, report.Tasks, func(s TimeSpent) []string {
+		return []string{strconv.Itoa(s.Task), s.Name, s.JiraKey}
+	})
+	t.printSpent([]string{"Tag", "Hours"}, report.Tags, func(s TimeSpent) []string { return []string{s.Name} })
+	t.printSpent([]string{"Day", "Hours"}, report.Days, func(s TimeSpent) []string { return []string{s.Name} })
+	fmt.Fprintf(t.stdout(), "\nTotal: %s (%.2f hours) since %s\n",
+		formatSpent(total), report.Hours, since.Format("2006-01-02 15:04"))
+	return nil
+}
+
+// printSpent prints a table of the time spent, the columns of each row
+// before the hours given by columns
+func (t *Todo) printSpent(header []string, spent []TimeSpent, columns func(TimeSpent) []string) {
+	fmt.Fprintln(t.stdout())
+	table := tablewriter.NewWriter(t.stdout())
+	table.SetHeader(header)
+	table.SetBorder(true)
+	for _, s := range spent {
+		table.Append(append(columns(s), fmt.Sprintf("%.2f", s.Hours)))
+	}
+	table.Render()
+}
+
+// sortedSpent returns the time spent by name, sorted by name
+func sortedSpent(byName map[string]time.Duration) []TimeSpent {
+	spent := make([]TimeSpent, 0, len(byName))
+	for name, d := range byName {
+		spent = append(spent, TimeSpent{Name: name, Hours: hours(d)})
+	}
+	sort.Slice(spent, func(i, j int) bool { return spent[i].Name < spent[j].Name })
+	return spent
+}
+
+// hours returns d in hours, rounded to minutes
+func hours(d time.Duration) float64 {
+	return d.Round(time.Minute).Minutes() / 60
+}
@@ -15,13 +15,26 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
 	"crypto/rsa"
+	"errors"
 	"fmt"
+	"io"
 	"jira"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 	"todo/internal/config"
+	"todo/internal/issuecache"
+	"todo/internal/journal"
+	"todo/internal/outbox"
+	"todo/internal/store"
+	"todo/internal/synced"
 
 	"github.com/dghubble/oauth1"
 	homedir "github.com/mitchellh/go-homedir"
@@ -33,13 +46,39 @@ import (
 type Todo struct {
 	PrivateKey *rsa.PrivateKey
 	Config     *config.Cfg
+	ConfigFile *config.File
+	Store      store.Store
+	Journal    *journal.Journal
+	Synced     *synced.Snapshots
+	Outbox     *outbox.Outbox
+	Issues     *issuecache.Cache
 	Token      string
 	JC         *jira.Client
+	// Profile is the profile in use, empty for the default one. JC is its
+	// client, clients are the ones of other profiles tasks are linked to
+	Profile string
+	clients map[string]*jira.Client
+	// setupErr is why the config file or the profile can't be used, only
+	// init and the profile commands run without them
+	setupErr error
+	// Output is the format chosen with --output and Template the template
+	// for --output template
+	Output   string
+	Template string
+	// Out is where output is written, stdout if nil, and In where answers
+	// are read from, stdin if nil
+	Out io.Writer
+	In  io.Reader
+	// Context cancels the Jira requests of a command when it is done, and
+	// Timeout limits every request
+	Context context.Context
+	Timeout time.Duration
 }
 
 var (
 	cfgFile     string
 	privKeyFile string
+	profileName string
 	t           *Todo
 )
 
@@ -67,10 +106,20 @@ func Execute() {
 			}
 
 		}*/
-	if err := rootCmd.Execute(); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t.Context = ctx
+	handleInterrupt(cancel)
+	err := t.Finish(rootCmd.Execute())
+	if err != nil {
 		switch {
-		case strings.Contains(err.Error(), "token_rejected"):
+		case errors.Is(err, context.Canceled):
+			fmt.Printf("Interrupted: %v\n", err)
+			os.Exit(130)
+		case jira.IsTokenRejected(err):
 			fmt.Println("Token has expired. Run 'todo init' again.")
+		case jira.IsUnauthorized(err):
+			fmt.Println("Jira didn't accept your credentials. Run 'todo init' again.")
 		default:
 			fmt.Println(err)
 		}
@@ -78,6 +127,79 @@ func Execute() {
 	}
 }
 
+// Finish ends a command that returned err. An out-of-sync task is repaired
+// while the store and the config file are still open, then both are closed
+func (t *Todo) Finish(err error) error {
+	if e, ok := err.(*OutOfSyncError); ok {
+		err = t.repair(e)
+	}
+	if t.Store != nil {
+		t.Store.Close()
+	}
+	if t.ConfigFile != nil {
+		t.ConfigFile.Close()
+	}
+	return err
+}
+
+// What Ctrl-C does while todo waits for the user, see waitForUser
+const (
+	running int32 = iota
+	prompting
+	editing
+)
+
+// interruptMode is what Ctrl-C does right now, one of the modes above
+var interruptMode int32
+
+// handleInterrupt calls cancel on Ctrl-C, so the running command stops at
+// the next Jira request and leaves the task as it was. A second Ctrl-C
+// quits right away, and so does the first one while a prompt waits for
+// input. While the editor is open, Ctrl-C is left to the editor
+func handleInterrupt(cancel context.CancelFunc) {
+	interrupted := make(chan os.Signal, 2)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		canceled := false
+		for range interrupted {
+			switch atomic.LoadInt32(&interruptMode) {
+			case editing:
+				continue
+			case prompting:
+				fmt.Fprintln(os.Stderr)
+				os.Exit(130)
+			}
+			if canceled {
+				os.Exit(130)
+			}
+			fmt.Fprintln(os.Stderr, "\nInterrupted, stopping. Press Ctrl-C again to quit right away")
+			cancel()
+			canceled = true
+		}
+	}()
+}
+
+// waitForUser sets what Ctrl-C does until the returned func is called
+func waitForUser(mode int32) func() {
+	atomic.StoreInt32(&interruptMode, mode)
+	return func() { atomic.StoreInt32(&interruptMode, running) }
+}
+
+// readLine reads a line of input, which Ctrl-C stops right away as there
+// is no Jira request to stop
+func readLine(r *bufio.Reader) (string, error) {
+	defer waitForUser(prompting)()
+	return r.ReadString('\n')
+}
+
+// ctx returns the context of the running command
+func (t *Todo) ctx() context.Context {
+	if t.Context == nil {
+		return context.Background()
+	}
+	return t.Context
+}
+
 func init() {
 	t = &Todo{}
 	rootCmd.PersistentFlags().StringVar(
@@ -90,8 +212,46 @@ func init() {
 		&privKeyFile,
 		"privkey",
 		"",
-		"private RSA key to authenticate against Jira (default is $HOME/.ssh/jira_privatekey.pem)",
+		"private RSA key to authenticate against Jira and encrypt the token (default is $HOME/.ssh/jira_privatekey.pem)",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&profileName,
+		"profile",
+		"",
+		"Jira profile to use (default is the one chosen with 'todo profile use')",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&t.Output,
+		"output",
+		"table",
+		fmt.Sprintf("output format [%s]", strings.Join(OutputFormats, ", ")),
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&t.Template,
+		"template",
+		"",
+		"Go template for --output template, e.g. '{{.ID}} {{.JiraKey}} {{.URL}}'",
 	)
+	rootCmd.PersistentFlags().DurationVar(
+		&t.Timeout,
+		"timeout",
+		jira.DefaultTimeout,
+		"time limit of every Jira request, 0 for none",
+	)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := t.checkSetup(cmd); err != nil {
+			return err
+		}
+		if err := t.checkOutput(); err != nil {
+			return err
+		}
+		switch cmd.Name() {
+		case "init", "flush", "status":
+		default:
+			t.autoFlush()
+		}
+		return nil
+	}
 	cobra.OnInitialize(t.initConfig)
 	//t.initConfig()
 }
@@ -112,40 +272,131 @@ func (t *Todo) initConfig() {
 		viper.SetConfigName("todo")
 	}
 
-	if privKeyFile == "" {
-		privKeyFile = fmt.Sprintf("%s/.ssh/jira_privatekey.pem", home)
-	}
-	t.PrivateKey, err = config.ReadRSAKey(privKeyFile)
+	configErr := viper.ReadInConfig()
+	t.PrivateKey, err = readPrivateKey(home)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	if err := viper.ReadInConfig(); err == nil {
+	if configErr == nil {
 		viper.SetConfigType("yaml")
-		t.Config, err = config.Read(viper.ConfigFileUsed())
+		t.ConfigFile, err = config.Open(viper.ConfigFileUsed())
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		if t.Config.Jira.Token != "" {
-			t.Token, err = config.Decrypt(t.PrivateKey, t.Config.Jira.Token)
+		t.Config, err = t.ConfigFile.Read()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		t.Store, err = store.Open(t.ConfigFile, t.Config)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		dir := filepath.Dir(viper.ConfigFileUsed())
+		t.Journal = journal.Open(filepath.Join(dir, "todo.journal"))
+		t.Synced, err = synced.Open(filepath.Join(dir, "todo.synced"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		t.Outbox, err = outbox.Open(filepath.Join(dir, "todo.outbox"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		t.Issues, err = issuecache.Open(filepath.Join(dir, "todo.issues"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		t.Profile = t.Config.Profile
+		if profileName != "" {
+			t.Profile = config.ProfileName(profileName)
+		}
+		j, err := t.Config.JiraProfile(t.Profile)
+		if err != nil {
+			t.setupErr = fmt.Errorf("%v. Run 'todo profile list' to see them", err)
+		} else if j.Token != "" {
+			t.JC, err = t.newJiraClient(j)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
 			}
-			t.initJiraClient()
+			t.Token = t.JC.Token
 		}
 	} else {
-		if !strings.Contains(strings.Join(os.Args, ","), "init") {
-			fmt.Println("Could not find configuration file. Run 'todo init'")
-			os.Exit(1)
+		t.setupErr = fmt.Errorf("Could not find configuration file. Run 'todo init'")
+	}
+}
+
+// checkSetup returns the error of reading the config file or choosing the
+// profile, unless cmd is init or manages the profiles and so sets them up
+func (t *Todo) checkSetup(cmd *cobra.Command) error {
+	if t.setupErr == nil || cmd.Name() == "init" {
+		return nil
+	}
+	if t.Config != nil && cmd.HasParent() && cmd.Parent().Name() == "profile" {
+		return nil
+	}
+	return t.setupErr
+}
+
+// configPath returns the config file in use, or where a new one should be
+// created if none was found
+func configPath() (string, error) {
+	if path := viper.ConfigFileUsed(); path != "" {
+		return path, nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/.config/todo/todo.yaml", home), nil
+}
+
+// readPrivateKey reads the key given with --privkey. Without it the key of
+// the application link in ~/.ssh is used, or else the key todo generated to
+// encrypt the token. Only a key given with --privkey has to exist
+func readPrivateKey(home string) (*rsa.PrivateKey, error) {
+	if privKeyFile != "" {
+		return config.ReadRSAKey(privKeyFile)
+	}
+	paths := []string{fmt.Sprintf("%s/.ssh/jira_privatekey.pem", home)}
+	if path, err := generatedKeyPath(); err == nil {
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		key, err := config.ReadRSAKey(path)
+		if !errors.Is(err, os.ErrNotExist) {
+			return key, err
 		}
 	}
+	return nil, nil
+}
 
+// generatedKeyPath is where todo keeps the key it generates to encrypt
+// tokens when there is no application link key
+func generatedKeyPath() (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "todo_key.pem"), nil
 }
 
-func (t *Todo) initJiraClient() {
-	t.JC = jira.NewClient(&oauth1.Config{
+// newJiraClient returns a client for the Jira settings of a profile
+func (t *Todo) newJiraClient(j *config.Jira) (*jira.Client, error) {
+	if t.PrivateKey == nil {
+		return nil, fmt.Errorf("No private key found to decrypt the Jira token. Use --privkey or run 'todo init' again")
+	}
+	token, err := config.Decrypt(t.PrivateKey, j.Token)
+	if err != nil {
+		return nil, err
+	}
+	jc := jira.NewClient(&oauth1.Config{
 		CallbackURL:    "oob",
 		ConsumerKey:    "Todo",
 		ConsumerSecret: "dont_care",
@@ -153,21 +404,105 @@ func (t *Todo) initJiraClient() {
 			PrivateKey: t.PrivateKey,
 		},
 	})
-	t.JC.PrivateKey = t.PrivateKey
-	t.JC.BaseURL = t.Config.Jira.URL
-	t.JC.Token = t.Token
+	jc.PrivateKey = t.PrivateKey
+	jc.HTTPClient.Timeout = t.Timeout
+	jc.BaseURL = j.URL
+	jc.Token = token
+	switch j.Auth {
+	case config.AuthBasic:
+		jc.Auth = &jira.BasicAuth{User: j.User, Token: token}
+	case config.AuthPAT:
+		jc.Auth = &jira.BearerAuth{Token: token}
+	}
+	return jc, nil
 }
 
-func (t *Todo) verifyIndex(args []string) (int, error) {
-	i, err := strconv.Atoi(args[0])
+// jiraConfig returns the Jira settings of the profile in use
+func (t *Todo) jiraConfig() *config.Jira {
+	if t.Config == nil {
+		return &config.Jira{}
+	}
+	j, err := t.Config.JiraProfile(t.Profile)
+	if err != nil {
+		return &config.Jira{}
+	}
+	return j
+}
+
+// jiraFor returns the client and the Jira settings of the profile the issue
+// of task belongs to
+func (t *Todo) jiraFor(task *config.Task) (*jira.Client, *config.Jira, error) {
+	if task.Profile == t.Profile {
+		if t.JC == nil {
+			return nil, nil, fmt.Errorf("Jira is not set up. Run 'todo init'")
+		}
+		return t.JC, t.jiraConfig(), nil
+	}
+	j, err := t.Config.JiraProfile(task.Profile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Task %d belongs to profile '%s', which no longer exists", task.ID, task.Profile)
+	}
+	if jc, ok := t.clients[task.Profile]; ok {
+		return jc, j, nil
+	}
+	jc, err := t.newJiraClient(j)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.clients == nil {
+		t.clients = map[string]*jira.Client{}
+	}
+	t.clients[task.Profile] = jc
+	return jc, j, nil
+}
+
+// useProfile records that task is linked to an issue in the project of the
+// profile in use
+func (t *Todo) useProfile(task *config.Task) {
+	task.Profile = t.Profile
+	task.Project = t.jiraConfig().Project.Key
+}
+
+// findTask resolves the supplied argument to a task. It can be a task ID,
+// a Jira key or a prefix of the task text matching exactly one task
+func (t *Todo) findTask(args []string) (*config.Task, error) {
+	ref := strings.TrimSpace(args[0])
+	if ref == "" {
+		return nil, fmt.Errorf("No task specified")
+	}
+	tasks, err := t.Store.Tasks()
 	if err != nil {
-		return 0, fmt.Errorf("Invalid index specified: %s", args[0])
+		return nil, fmt.Errorf("Unable to read tasks: %v", err)
+	}
+	if id, err := strconv.Atoi(ref); err == nil {
+		for _, task := range tasks {
+			if task.ID == id {
+				return task, nil
+			}
+		}
+		return nil, fmt.Errorf("No task with ID %d", id)
+	}
+	for _, task := range tasks {
+		if task.JiraKey != "" && strings.EqualFold(task.JiraKey, ref) {
+			return task, nil
+		}
+	}
+	var matches []*config.Task
+	for _, task := range tasks {
+		if strings.HasPrefix(strings.ToLower(task.Text), strings.ToLower(ref)) {
+			matches = append(matches, task)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("No task matching '%s'", ref)
+	case 1:
+		return matches[0], nil
 	}
-	switch {
-	case i <= 0:
-		return 0, fmt.Errorf("Invalid index specified: %d", i)
-	case i > len(t.Config.Tasks):
-		return 0, fmt.Errorf("Invalid index specified: %d", i)
+	var ids []string
+	for _, task := range matches {
+		ids = append(ids, strconv.Itoa(task.ID))
 	}
-	return i - 1, nil
+	return nil, fmt.Errorf("'%s' matches several tasks (%s), use the task ID",
+		ref, strings.Join(ids, ", "))
 }
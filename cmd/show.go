@@ -0,0 +1,365 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"jira"
+	"sort"
+	"strings"
+	"time"
+	"todo/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// showCmd represents the show command
+var showCmd = &cobra.Command{
+	Use:   "show <id>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Shows everything about the supplied task",
+	Long: `Shows a task with its full text, dates, tags, time spent, notes and whether it
+is in sync with Jira. For tasks linked to Jira the issue is fetched as well,
+with its status, assignee, reporter, priority, labels, sprint and description,
+and the notes are merged with the comments of the issue, oldest first.
+
+While Jira can't be reached the issue is shown as it was the last time it was
+fetched`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		comments, _ := cmd.Flags().GetInt("comments")
+		return t.Show(args, comments)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(showCmd)
+	showCmd.Flags().IntP("comments", "n", 5, "Number of recent notes and comments shown, 0 shows all")
+}
+
+// ThreadEntry is a note or a comment on the Jira issue of a task
+type ThreadEntry struct {
+	Time   time.Time `yaml:"time" json:"time"`
+	Author string    `yaml:"author,omitempty" json:"author,omitempty"`
+	Text   string    `yaml:"text" json:"text"`
+	// CommentID is the Jira comment, empty for notes that aren't in Jira
+	CommentID string `yaml:"comment_id,omitempty" json:"comment_id,omitempty"`
+}
+
+// IssueDetails is the Jira issue of a task as shown by todo show
+type IssueDetails struct {
+	Status         string    `yaml:"status" json:"status"`
+	StatusCategory string    `yaml:"status_category" json:"status_category"`
+	Assignee       string    `yaml:"assignee,omitempty" json:"assignee,omitempty"`
+	Reporter       string    `yaml:"reporter,omitempty" json:"reporter,omitempty"`
+	Priority       string    `yaml:"priority,omitempty" json:"priority,omitempty"`
+	Labels         []string  `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Sprint         string    `yaml:"sprint,omitempty" json:"sprint,omitempty"`
+	Description    string    `yaml:"description,omitempty" json:"description,omitempty"`
+	Created        time.Time `yaml:"created" json:"created"`
+	Updated        time.Time `yaml:"updated" json:"updated"`
+	// Fetched is when the issue was fetched. Cached is set if Jira couldn't
+	// be reached and the issue is the one fetched last
+	Fetched time.Time `yaml:"fetched" json:"fetched"`
+	Cached  bool      `yaml:"cached,omitempty" json:"cached,omitempty"`
+}
+
+// SyncState tells whether a task and its Jira issue agree
+type SyncState struct {
+	// Synced is when the task and the issue last agreed
+	Synced time.Time `yaml:"synced,omitempty" json:"synced,omitempty"`
+	// Queued are the kinds of the changes waiting for Jira, Rejected the
+	// errors of the changes Jira refused
+	Queued   []string `yaml:"queued,omitempty" json:"queued,omitempty"`
+	Rejected []string `yaml:"rejected,omitempty" json:"rejected,omitempty"`
+}
+
+// TaskDetails is a task as printed by todo show
+type TaskDetails struct {
+	TaskOutput `yaml:",inline"`
+	Issue      *IssueDetails `yaml:"issue,omitempty" json:"issue,omitempty"`
+	Sync       SyncState     `yaml:"sync" json:"sync"`
+	Thread     []ThreadEntry `yaml:"thread,omitempty" json:"thread,omitempty"`
+}
+
+// Show prints a task, its Jira issue and its notes and comments. Tables
+// only get the last comments entries of the thread, all of them if
+// comments is 0
+func (t *Todo) Show(args []string, comments int) error {
+	if err := t.checkOutput(); err != nil {
+		return err
+	}
+	task, err := t.findTask(args)
+	if err != nil {
+		return err
+	}
+	details := TaskDetails{TaskOutput: t.taskOutput(task), Sync: t.syncState(task)}
+	var issueComments []jira.Comment
+	if task.JiraID != "" {
+		var issue *jira.Issue
+		details.Issue, issue = t.issueDetails(task)
+		if issue != nil && issue.Fields.Comment != nil {
+			issueComments = issue.Fields.Comment.Comments
+		}
+	}
+	details.Thread = mergeThread(task.Notes, issueComments)
+	switch t.Output {
+	case "json", "yaml":
+		return t.encode(details)
+	case "", "table":
+		return t.printDetails(details, comments)
+	}
+	return t.printTask(task)
+}
+
+// issueDetails fetches the issue of task and caches it. If that fails the
+// cached issue is returned, or nil if there is none
+func (t *Todo) issueDetails(task *config.Task) (*IssueDetails, *jira.Issue) {
+	jc, _, err := t.jiraFor(task)
+	if err == nil {
+		var issue *jira.Issue
+		if issue, err = jc.GetIssueContext(t.ctx(), task.JiraID); err == nil {
+			if t.Issues != nil {
+				if err := t.Issues.Set(task.ID, issue); err != nil {
+					t.status("Unable to cache Jira issue %s: %v", task.JiraKey, err)
+				}
+			}
+			return newIssueDetails(issue, time.Now()), issue
+		}
+		err = explain(task, err)
+	}
+	if t.Issues != nil {
+		if e, ok := t.Issues.Get(task.ID); ok && e.Issue.ID == task.JiraID {
+			t.status("Unable to get Jira issue %s, showing it as of %s: %v",
+				task.JiraKey, e.Time.Format("2006-01-02 15:04"), err)
+			d := newIssueDetails(e.Issue, e.Time)
+			d.Cached = true
+			return d, e.Issue
+		}
+	}
+	t.status("Unable to get Jira issue %s: %v", task.JiraKey, err)
+	return nil, nil
+}
+
+func newIssueDetails(issue *jira.Issue, fetched time.Time) *IssueDetails {
+	f := issue.Fields
+	d := &IssueDetails{
+		Assignee:    userName(f.Assignee),
+		Reporter:    userName(f.Reporter),
+		Labels:      f.Labels,
+		Description: f.Description,
+		Created:     jiraTime(f.Created),
+		Updated:     jiraTime(f.Updated),
+		Fetched:     fetched,
+	}
+	if f.Status != nil {
+		d.Status = f.Status.Name
+		d.StatusCategory = f.Status.StatusCategory.Name
+	}
+	if f.Priority != nil {
+		d.Priority = f.Priority.Name
+	}
+	if s := issue.CurrentSprint(); s != nil {
+		d.Sprint = s.Name
+		if s.Active() {
+			d.Sprint += " (active)"
+		}
+	}
+	return d
+}
+
+func userName(u *jira.User) string {
+	switch {
+	case u == nil:
+		return ""
+	case u.DisplayName != "":
+		return u.DisplayName
+	}
+	return u.Name
+}
+
+// jiraTime parses a timestamp of Jira, the zero time if it isn't one
+func jiraTime(s string) time.Time {
+	tm, _ := time.Parse(jira.TimeFormat, s)
+	return tm
+}
+
+// syncState returns whether task agrees with its issue as far as the local
+// state tells
+func (t *Todo) syncState(task *config.Task) SyncState {
+	var s SyncState
+	if t.Synced != nil {
+		if state, ok := t.Synced.Get(task.ID); ok {
+			s.Synced = state.Time
+		}
+	}
+	if t.Outbox != nil {
+		for _, op := range t.Outbox.Ops() {
+			switch {
+			case op.TaskID != task.ID:
+			case op.Failed:
+				s.Rejected = append(s.Rejected, fmt.Sprintf("%s: %s", op.Kind, op.Error))
+			default:
+				s.Queued = append(s.Queued, op.Kind)
+			}
+		}
+	}
+	return s
+}
+
+// mergeThread merges notes and comments, oldest first. A note that is one
+// of the comments is only listed once, as the comment
+func mergeThread(notes []config.Note, comments []jira.Comment) []ThreadEntry {
+	var thread []ThreadEntry
+	seen := map[string]bool{}
+	for _, c := range comments {
+		seen[c.ID] = true
+		thread = append(thread, ThreadEntry{Time: c.CreatedTime(), Author: userName(c.Author), Text: c.Body, CommentID: c.ID})
+	}
+	for _, n := range notes {
+		if n.CommentID != "" && seen[n.CommentID] {
+			continue
+		}
+		thread = append(thread, ThreadEntry{Time: n.Time, Text: n.Text, CommentID: n.CommentID})
+	}
+	sort.SliceStable(thread, func(i, j int) bool { return thread[i].Time.Before(thread[j].Time) })
+	return thread
+}
+
+// printDetails prints the task, its issue and the last comments entries of
+// its thread for people
+func (t *Todo) printDetails(d TaskDetails, comments int) error {
+	w := t.stdout()
+	state := "open"
+	if d.Done {
+		state = "done"
+	}
+	fmt.Fprintf(w, "Task %d: %s\n\n", d.ID, d.Text)
+	field(w, "State", state)
+	field(w, "Priority", d.Priority)
+	field(w, "Tags", strings.Join(d.Tags, ", "))
+	field(w, "Created", showTime(d.Created))
+	field(w, "Start", showTime(d.Start))
+	field(w, "Due", showTime(d.Due))
+	field(w, "Repeats", recurSummary(d.Recur))
+	field(w, "Completed", showTime(d.Completed))
+	field(w, "Time spent", timeSummary(d.TimeEntries))
+	field(w, "Jira", strings.TrimSpace(d.JiraKey+" "+d.URL))
+	field(w, "Sync", syncSummary(d))
+	for _, r := range d.Sync.Rejected {
+		field(w, "Rejected", r)
+	}
+
+	if i := d.Issue; i != nil {
+		fetched := "fetched " + showTime(i.Fetched)
+		if i.Cached {
+			fetched = "cached, as of " + showTime(i.Fetched)
+		}
+		fmt.Fprintf(w, "\nJira issue %s (%s)\n\n", d.JiraKey, fetched)
+		field(w, "Status", fmt.Sprintf("%s (%s)", i.Status, i.StatusCategory))
+		field(w, "Assignee", i.Assignee)
+		field(w, "Reporter", i.Reporter)
+		field(w, "Priority", i.Priority)
+		field(w, "Labels", strings.Join(i.Labels, ", "))
+		field(w, "Sprint", i.Sprint)
+		field(w, "Created", showTime(i.Created))
+		field(w, "Updated", showTime(i.Updated))
+		if i.Description != "" {
+			fmt.Fprintf(w, "\n%s\n", indent(i.Description))
+		}
+	}
+
+	thread := d.Thread
+	if len(thread) == 0 {
+		fmt.Fprintf(w, "\nNo notes\n")
+		return nil
+	}
+	if comments > 0 && len(thread) > comments {
+		fmt.Fprintf(w, "\nNotes, the last %d of %d:\n", comments, len(thread))
+		thread = thread[len(thread)-comments:]
+	} else {
+		fmt.Fprintf(w, "\nNotes:\n")
+	}
+	for _, e := range thread {
+		by := e.Author
+		switch {
+		case by == "" && d.JiraKey != "" && e.CommentID == "":
+			by = "you, not in Jira yet"
+		case by == "":
+			by = "you"
+		}
+		fmt.Fprintf(w, "\n%s  %s\n%s\n", showTime(e.Time), by, indent(e.Text))
+	}
+	return nil
+}
+
+// syncSummary describes whether the task and its issue are in sync
+func syncSummary(d TaskDetails) string {
+	var parts []string
+	switch {
+	case len(d.Sync.Queued) > 0:
+		parts = append(parts, fmt.Sprintf("%d changes waiting for Jira (%s)",
+			len(d.Sync.Queued), strings.Join(d.Sync.Queued, ", ")))
+	case d.JiraKey == "":
+		parts = append(parts, "not linked to Jira")
+	case d.Sync.Synced.IsZero():
+		parts = append(parts, "never synced")
+	default:
+		parts = append(parts, "in sync since "+showTime(d.Sync.Synced))
+	}
+	if n := len(d.Sync.Rejected); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d changes rejected by Jira", n))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// timeSummary sums up the time entries, empty if there are none
+func timeSummary(entries []config.TimeEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	now := time.Now()
+	var total time.Duration
+	for _, e := range entries {
+		total += e.Duration(now)
+	}
+	summary := formatSpent(total)
+	for _, e := range entries {
+		if e.Running() {
+			summary += ", timer running since " + showTime(e.Start)
+		}
+	}
+	return summary
+}
+
+// showTime formats tm in local time, empty if it is zero
+func showTime(tm time.Time) string {
+	if tm.IsZero() {
+		return ""
+	}
+	return tm.Local().Format("2006-01-02 15:04")
+}
+
+// field prints a labelled value, nothing if it is empty
+func field(w io.Writer, label, value string) {
+	if value != "" {
+		fmt.Fprintf(w, "%-11s %s\n", label+":", value)
+	}
+}
+
+// indent indents every line of s by four spaces
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n    ")
+}
@@ -0,0 +1,94 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"todo/internal/outbox"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Args:  cobra.NoArgs,
+	Short: "Shows the changes waiting to be sent to Jira",
+	Long: `Lists the changes that were queued while Jira couldn't be reached, in the order
+they will be sent by 'todo flush'. Changes Jira rejected are listed with the
+error and are not sent again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.Status()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
+
+// Status prints the queued Jira changes
+func (t *Todo) Status() error {
+	if t.Outbox == nil {
+		return fmt.Errorf("No outbox available")
+	}
+	ops := t.Outbox.Ops()
+	switch t.Output {
+	case "json", "yaml":
+		if ops == nil {
+			ops = []*outbox.Op{}
+		}
+		return t.encode(ops)
+	}
+	if len(ops) == 0 {
+		t.status("No queued changes, Jira is up to date")
+		return nil
+	}
+	table := tablewriter.NewWriter(t.stdout())
+	table.SetHeader([]string{"#", "Change", "Task", "Issue", "Queued", "Attempts", "Next try", "Error"})
+	table.SetBorder(true)
+	for _, op := range ops {
+		next := ""
+		switch {
+		case op.Failed:
+			next = "rejected"
+		case !op.NextTry.IsZero():
+			next = op.NextTry.Format("2006-01-02 15:04:05")
+		}
+		table.Append([]string{
+			fmt.Sprintf("%d", op.Seq),
+			op.Kind,
+			fmt.Sprintf("%d", op.TaskID),
+			op.JiraKey,
+			op.Time.Format("2006-01-02 15:04:05"),
+			fmt.Sprintf("%d", op.Attempts),
+			next,
+			op.Error,
+		})
+	}
+	table.Render()
+	return nil
+}
+
+// pendingError is returned by commands that need Jira to be up to date
+func (t *Todo) pendingError() error {
+	if t.Outbox == nil {
+		return nil
+	}
+	if n := len(t.Outbox.Pending()); n > 0 {
+		return fmt.Errorf("%d changes are waiting to be sent to Jira. Run 'todo flush' first", n)
+	}
+	return nil
+}
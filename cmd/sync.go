@@ -0,0 +1,347 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"jira"
+	"os"
+	"strings"
+	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/synced"
+
+	"github.com/spf13/cobra"
+)
+
+// syncBatch is the number of issues fetched per search
+const syncBatch = 50
+
+// Conflict policies accepted by --prefer
+const (
+	PreferAsk    = "ask"
+	PreferLocal  = "local"
+	PreferRemote = "remote"
+	PreferSkip   = "skip"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Args:  cobra.NoArgs,
+	Short: "Syncs your linked tasks with their Jira issues",
+	Long: `Fetches the Jira issue of every linked task and brings the task and the issue
+in line. Changes to the text (the issue summary) and to the done state made on
+either side are copied to the other side, and tasks whose issue was moved get
+the new key.
+
+When the same field was changed on both sides since the last sync, or the issue
+was deleted in Jira, --prefer decides what happens:
+
+  ask     ask for every conflict (default)
+  local   keep the task, and create a new issue for deleted ones
+  remote  keep the issue, and delete tasks whose issue was deleted
+  skip    leave conflicts for a later sync`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prefer, _ := cmd.Flags().GetString("prefer")
+		return t.Sync(prefer)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().String("prefer", PreferAsk, "How to resolve conflicts [ask, local, remote, skip]")
+}
+
+// Sync reconciles every linked task with its Jira issue. Conflicts are
+// resolved as prefer says
+func (t *Todo) Sync(prefer string) error {
+	switch prefer {
+	case PreferAsk, PreferLocal, PreferRemote, PreferSkip:
+	default:
+		return fmt.Errorf("Invalid value for prefer. Valid options are: [ask, local, remote, skip]")
+	}
+	if t.Synced == nil {
+		return fmt.Errorf("No sync state available")
+	}
+	if err := t.pendingError(); err != nil {
+		return err
+	}
+	tasks, err := t.Store.Tasks()
+	if err != nil {
+		return fmt.Errorf("Unable to read tasks: %v", err)
+	}
+	var linked []*config.Task
+	ids := map[string][]string{}
+	for _, task := range tasks {
+		if task.JiraID != "" {
+			linked = append(linked, task)
+			ids[task.Profile] = append(ids[task.Profile], task.JiraID)
+		}
+	}
+	if len(linked) == 0 {
+		t.status("No linked tasks to sync")
+		return nil
+	}
+	// Issue IDs are only unique within one Jira, so issues are fetched and
+	// looked up by profile
+	issues := map[string]map[string]*jira.Issue{}
+	for _, task := range linked {
+		if _, ok := issues[task.Profile]; ok {
+			continue
+		}
+		jc, _, err := t.jiraFor(task)
+		if err != nil {
+			return err
+		}
+		if issues[task.Profile], err = t.fetchIssues(jc, ids[task.Profile]); err != nil {
+			return err
+		}
+	}
+	r := &resolver{prefer: prefer, in: bufio.NewReader(os.Stdin)}
+	var changed, skipped int
+	for _, task := range linked {
+		var err error
+		var what string
+		if issue, ok := issues[task.Profile][task.JiraID]; ok {
+			what, err = t.syncTask(task, issue, r)
+		} else {
+			what, err = t.syncDeleted(task, r)
+		}
+		if err != nil {
+			return err
+		}
+		switch what {
+		case "":
+		case "skipped":
+			skipped++
+			t.status("%s: conflict skipped", task.JiraKey)
+		default:
+			changed++
+			t.status("%s: %s", task.JiraKey, what)
+		}
+	}
+	t.status("Synced %d tasks, %d changed, %d conflicts skipped", len(linked), changed, skipped)
+	return nil
+}
+
+// fetchIssues returns the Jira issues of jc with the supplied IDs by ID.
+// Issues that no longer exist are missing from the result
+func (t *Todo) fetchIssues(jc *jira.Client, ids []string) (map[string]*jira.Issue, error) {
+	issues := map[string]*jira.Issue{}
+	for start := 0; start < len(ids); start += syncBatch {
+		end := start + syncBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		search, err := json.Marshal(map[string]interface{}{
+			"jql":        fmt.Sprintf("id in (%s)", strings.Join(ids[start:end], ",")),
+			"startAt":    0,
+			"maxResults": end - start,
+			"fields":     []string{"summary", "status"},
+			// Deleted issues would fail the whole search otherwise
+			"validateQuery": "warn",
+		})
+		if err != nil {
+			return nil, err
+		}
+		found, err := jc.SearchIssuesContext(t.ctx(), search)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to fetch Jira issues: %w", err)
+		}
+		for i := range found {
+			issues[found[i].ID] = &found[i]
+		}
+	}
+	return issues, nil
+}
+
+// syncTask reconciles task with its issue. It returns what was done, an
+// empty string if they were already in sync or "skipped"
+func (t *Todo) syncTask(task *config.Task, issue *jira.Issue, r *resolver) (string, error) {
+	local := synced.Of(task)
+	remote := synced.State{Key: issue.Key, Text: issueText(issue), Done: issue.Done()}
+	// Without a snapshot the task is assumed to be what was last sent to
+	// Jira, so every difference is a change made in Jira
+	base, ok := t.Synced.Get(task.ID)
+	if !ok {
+		base = local
+	}
+
+	// Fields changed on one side only are taken from that side, fields
+	// changed on both sides are conflicts
+	merged := local
+	merged.Key = remote.Key
+	textConflict := remote.Text != local.Text && local.Text != base.Text && remote.Text != base.Text
+	doneConflict := remote.Done != local.Done && local.Done != base.Done && remote.Done != base.Done
+	if local.Text == base.Text {
+		merged.Text = remote.Text
+	}
+	if local.Done == base.Done {
+		merged.Done = remote.Done
+	}
+	var conflicts []string
+	if textConflict {
+		conflicts = append(conflicts, fmt.Sprintf("text is '%s' here and '%s' in Jira", local.Text, remote.Text))
+	}
+	if doneConflict {
+		conflicts = append(conflicts, fmt.Sprintf("done is %v here and %v in Jira", local.Done, remote.Done))
+	}
+	if len(conflicts) > 0 {
+		switch r.resolve(task, conflicts) {
+		case PreferSkip:
+			return "skipped", nil
+		case PreferRemote:
+			if textConflict {
+				merged.Text = remote.Text
+			}
+			if doneConflict {
+				merged.Done = remote.Done
+			}
+		}
+	}
+
+	target := task.Clone()
+	target.JiraKey = merged.Key
+	target.Text = merged.Text
+	setDone(target, merged.Done)
+	// current is the task as Jira has it
+	current := task.Clone()
+	current.JiraKey = remote.Key
+	current.Text = remote.Text
+	current.Done = remote.Done
+
+	push := !merged.Same(remote)
+	pull := !merged.Same(local)
+	if !push && !pull {
+		if !ok || !base.Same(local) {
+			if err := t.Synced.Set(task); err != nil {
+				return "", fmt.Errorf("Unable to save the synced state: %v", err)
+			}
+		}
+		return "", nil
+	}
+	c := change{
+		task:  target,
+		local: func() error { return t.Store.Update(target) },
+	}
+	if pull {
+		c.entry = &journal.Entry{Op: "sync", Before: task.Clone()}
+	}
+	if push {
+		c.remote = func() error { return t.updateJira(current, target) }
+		c.rollback = func() error { return t.updateJira(target, current) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was updated", target.JiraKey) }
+		c.repair = "Run 'todo sync' again."
+	}
+	if err := t.apply(c); err != nil {
+		return "", err
+	}
+	if err := t.Synced.Set(target); err != nil {
+		return "", fmt.Errorf("Unable to save the synced state: %v", err)
+	}
+	var what []string
+	if pull {
+		what = append(what, "updated from Jira")
+	}
+	if push {
+		what = append(what, "Jira issue updated")
+	}
+	return strings.Join(what, ", "), nil
+}
+
+// syncDeleted handles a task whose issue no longer exists in Jira
+func (t *Todo) syncDeleted(task *config.Task, r *resolver) (string, error) {
+	switch r.resolve(task, []string{"the issue was deleted in Jira"}) {
+	case PreferSkip:
+		return "skipped", nil
+	case PreferRemote:
+		err := t.apply(change{
+			task:    task,
+			local:   func() error { return t.Store.Delete(task.ID) },
+			entry:   &journal.Entry{Op: "sync", Before: task.Clone()},
+			deleted: true,
+		})
+		if err != nil {
+			return "", err
+		}
+		return "deleted in Jira, task deleted", nil
+	}
+	target := task.Clone()
+	err := t.apply(change{
+		task: target,
+		remote: func() error {
+			if err := t.createJira(target); err != nil {
+				return err
+			}
+			if target.Done {
+				return t.transition(target, true)
+			}
+			return nil
+		},
+		local:    func() error { return t.Store.Update(target) },
+		rollback: func() error { return t.deleteIssue(target) },
+		done:     func() string { return fmt.Sprintf("Jira issue %s was created", target.JiraKey) },
+		repair:   "Delete the Jira issue and run 'todo sync' again.",
+		entry:    &journal.Entry{Op: "sync", Before: task.Clone()},
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("deleted in Jira, created %s", target.JiraKey), nil
+}
+
+// issueText returns the task text of an issue created from a task
+func issueText(issue *jira.Issue) string {
+	return strings.TrimPrefix(issue.Fields.Summary, "TODO: ")
+}
+
+// resolver decides how conflicts are resolved
+type resolver struct {
+	prefer string
+	in     *bufio.Reader
+}
+
+// resolve returns PreferLocal, PreferRemote or PreferSkip for a conflict
+// on task. Unless told otherwise it asks, or skips when it can't ask
+func (r *resolver) resolve(task *config.Task, conflicts []string) string {
+	if r.prefer != PreferAsk {
+		return r.prefer
+	}
+	if !isTerminal(os.Stdin) {
+		return PreferSkip
+	}
+	fmt.Fprintf(os.Stderr, "\nTask %d (%s) is in conflict with Jira:\n", task.ID, task.JiraKey)
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "  %s\n", c)
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "Keep [l]ocal, keep [r]emote or [s]kip?: ")
+		answer, err := readLine(r.in)
+		if err != nil {
+			return PreferSkip
+		}
+		switch strings.TrimSpace(strings.ToLower(answer)) {
+		case "l", "local":
+			return PreferLocal
+		case "r", "remote":
+			return PreferRemote
+		case "s", "skip":
+			return PreferSkip
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"jira"
+	"strings"
+	"time"
+	"todo/internal/config"
+	"todo/internal/outbox"
+
+	"github.com/spf13/cobra"
+)
+
+// startCmd represents the start command
+var startCmd = &cobra.Command{
+	Use:   "start <id>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Starts a timer on the supplied task",
+	Long: `Starts tracking the time spent on a task until 'todo stop'. Only one timer runs
+at a time, a timer running on another task is stopped first. The timer keeps
+running when the tool exits`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.StartTimer(args)
+	},
+}
+
+// stopCmd represents the stop command
+var stopCmd = &cobra.Command{
+	Use:   "stop [message]",
+	Short: "Stops the running timer",
+	Long: `Stops the running timer and records the time spent on its task. For tasks
+linked to Jira the time is logged on the issue, with the message as the
+comment of the worklog`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.StopTimer(strings.Join(args, " "))
+	},
+}
+
+// logCmd represents the log command
+var logCmd = &cobra.Command{
+	Use:   "log <id> <duration> [message]",
+	Args:  cobra.MinimumNArgs(2),
+	Short: "Records time spent on the supplied task",
+	Long: `Records time spent on a task, ending now. The duration is given like "1h30m",
+"45m" or "1.5h". For tasks linked to Jira the time is logged on the issue as
+well, with the message as the comment of the worklog`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := parseSpent(args[1])
+		if err != nil {
+			return err
+		}
+		return t.LogTime(args[:1], d, strings.Join(args[2:], " "))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(startCmd)
+	rootCmd.AddCommand(stopCmd)
+	rootCmd.AddCommand(logCmd)
+}
+
+// parseSpent parses a duration like "1h30m" or "1h 30m"
+func parseSpent(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.Join(strings.Fields(s), ""))
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("Invalid duration '%s', use e.g. 1h30m or 45m", s)
+	}
+	return d, nil
+}
+
+// StartTimer starts a timer on a task, stopping the one running on another
+// task if any
+func (t *Todo) StartTimer(args []string) error {
+	task, err := t.findTask(args)
+	if err != nil {
+		return err
+	}
+	if task.Done {
+		return fmt.Errorf("Task '%s' is completed", task.Text)
+	}
+	running, err := t.runningTimer()
+	if err != nil {
+		return err
+	}
+	if running != nil && running.ID == task.ID {
+		return fmt.Errorf("The timer of task '%s' is already running", task.Text)
+	}
+	if running != nil {
+		if err := t.stopTimer(running, ""); err != nil {
+			return err
+		}
+		// The stop may have been saved to a copy of task
+		if task, err = t.findTask(args); err != nil {
+			return err
+		}
+	}
+	t.status("Starting timer on task: '%s'", task.Text)
+	return t.apply(change{
+		task: task,
+		local: func() error {
+			task.TimeEntries = append(task.TimeEntries, config.TimeEntry{Start: time.Now()})
+			return t.Store.Update(task)
+		},
+	})
+}
+
+// StopTimer stops the running timer and records the time spent
+func (t *Todo) StopTimer(message string) error {
+	task, err := t.runningTimer()
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return fmt.Errorf("No timer is running")
+	}
+	return t.stopTimer(task, message)
+}
+
+func (t *Todo) stopTimer(task *config.Task, message string) error {
+	i := task.Timer()
+	e := task.TimeEntries[i]
+	e.End = time.Now()
+	e.Message = strings.TrimSpace(message)
+	t.status("Stopping timer on task '%s' after %s", task.Text, formatSpent(e.Duration(time.Now())))
+	return t.saveTimeEntry(task, i, e)
+}
+
+// LogTime records d spent on a task, ending now
+func (t *Todo) LogTime(args []string, d time.Duration, message string) error {
+	task, err := t.findTask(args)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	t.status("Logging %s on task: '%s'", formatSpent(d), task.Text)
+	return t.saveTimeEntry(task, len(task.TimeEntries), config.TimeEntry{
+		Start:   now.Add(-d),
+		End:     now,
+		Message: strings.TrimSpace(message),
+	})
+}
+
+// runningTimer returns the task whose timer is running, nil if none is
+func (t *Todo) runningTimer() (*config.Task, error) {
+	tasks, err := t.Store.Tasks()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read tasks: %v", err)
+	}
+	for _, task := range tasks {
+		if task.Timer() >= 0 {
+			return task, nil
+		}
+	}
+	return nil, nil
+}
+
+// saveTimeEntry saves the finished time entry e as entry i of task, or as
+// a new one if i is the number of entries. It is logged on the issue of the
+// task first. If Jira rejects the worklog the time is saved all the same,
+// and the worklog is kept in the outbox as rejected
+func (t *Todo) saveTimeEntry(task *config.Task, i int, e config.TimeEntry) error {
+	var rejected error
+	c := change{
+		task: task,
+		local: func() error {
+			if i == len(task.TimeEntries) {
+				task.TimeEntries = append(task.TimeEntries, e)
+			} else {
+				task.TimeEntries[i] = e
+			}
+			return t.Store.Update(task)
+		},
+	}
+	if task.JiraID != "" {
+		c.remote = func() error {
+			var err error
+			e.WorklogID, err = t.addWorklog(task, e)
+			var apiErr *jira.APIError
+			if errors.As(err, &apiErr) {
+				rejected, err = err, nil
+			}
+			return err
+		}
+		c.rollback = func() error { return t.deleteWorklog(task, e.WorklogID) }
+		c.queue = func() []*outbox.Op { return worklogOps(task) }
+		c.done = func() string { return fmt.Sprintf("The time was logged on Jira issue %s", task.JiraKey) }
+		c.repair = fmt.Sprintf("Delete the worklog from %s and log the time again.", task.JiraKey)
+	}
+	if err := t.apply(c); err != nil || rejected == nil {
+		return err
+	}
+	t.status("Jira rejected the worklog of task %d, the time is only saved in todo: %v", task.ID, rejected)
+	if t.Outbox == nil {
+		return nil
+	}
+	ops := worklogOps(task)
+	if err := t.Outbox.Add(ops...); err != nil {
+		return fmt.Errorf("Unable to save outbox: %v", err)
+	}
+	if err := t.Outbox.Fail(ops[0], rejected); err != nil {
+		return fmt.Errorf("Unable to save outbox: %v", err)
+	}
+	return nil
+}
+
+// addWorklog logs the time entry on the issue of task and returns the ID
+// of the worklog. Jira logs whole minutes, at least one
+func (t *Todo) addWorklog(task *config.Task, e config.TimeEntry) (string, error) {
+	jc, _, err := t.jiraFor(task)
+	if err != nil {
+		return "", err
+	}
+	seconds := int(e.Duration(time.Now()).Round(time.Minute).Seconds())
+	if seconds < 60 {
+		seconds = 60
+	}
+	w, err := jc.AddWorklogContext(t.ctx(), task.JiraID, &jira.Worklog{
+		Comment:          e.Message,
+		Started:          e.Start.Format(jira.TimeFormat),
+		TimeSpentSeconds: seconds,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to log work in Jira: %w", err)
+	}
+	return w.ID, nil
+}
+
+// deleteWorklog deletes a worklog from the issue of task
+func (t *Todo) deleteWorklog(task *config.Task, worklogID string) error {
+	jc, _, err := t.jiraFor(task)
+	if err != nil {
+		return err
+	}
+	if err := jc.DeleteWorklogContext(t.ctx(), task.JiraID, worklogID); err != nil {
+		return fmt.Errorf("Unable to delete Jira worklog: %w", err)
+	}
+	return nil
+}
+
+// worklogItems are the finished time entries of task, which are logged on
+// its issue
+func (t *Todo) worklogItems(task *config.Task) items {
+	return items{
+		len: len(task.TimeEntries),
+		pending: func(i int) bool {
+			return !task.TimeEntries[i].Running() && task.TimeEntries[i].WorklogID == ""
+		},
+		post: func(i int) (err error) {
+			task.TimeEntries[i].WorklogID, err = t.addWorklog(task, task.TimeEntries[i])
+			return err
+		},
+		posted: "The time was logged on",
+	}
+}
+
+// worklogOps queues logging the time entries of task
+func worklogOps(task *config.Task) []*outbox.Op {
+	return []*outbox.Op{{Kind: outbox.Worklog, TaskID: task.ID, JiraKey: task.JiraKey}}
+}
+
+// formatSpent formats d in hours and minutes, e.g. "1h 30m"
+func formatSpent(d time.Duration) string {
+	d = d.Round(time.Minute)
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	}
+	return fmt.Sprintf("%dh %dm", h, m)
+}
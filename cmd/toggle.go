@@ -16,18 +16,20 @@ package cmd
 
 import (
 	"fmt"
-	"jira"
-	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/outbox"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // toggleCmd represents the toggle command
 var toggleCmd = &cobra.Command{
-	Use:   "toggle",
+	Use:   "toggle <id>",
 	Args:  cobra.ExactArgs(1),
 	Short: "Toggles the supplied task between offline/online",
+	Long: `Toggles a task between offline and online. The task can be given by its
+ID, its Jira key or the beginning of its text as long as that matches only one
+task`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return t.Toggle(args)
 	},
@@ -39,33 +41,50 @@ func init() {
 
 // Toggle a task online/offline
 func (t *Todo) Toggle(args []string) error {
-	var i int
-	var err error
-	if i, err = t.verifyIndex(args); err != nil {
+	task, err := t.findTask(args)
+	if err != nil {
 		return err
 	}
-	task := t.Config.Tasks[i]
+	entry := &journal.Entry{Op: "toggle", Before: task.Clone()}
 	switch task.JiraID {
 	case "":
-		fmt.Printf("Creating Jira issue for '%s'\n", task.Text)
-		issue := &jira.Issue{
-			Fields: jira.Fields{
-				Summary: fmt.Sprintf("TODO: %s", task.Text),
-				Project: jira.IssueProject{
-					ID: t.Config.Jira.Project.ID,
-				},
-				IssueType: jira.IssueType{
-					ID: t.Config.Jira.Project.IssueType,
-				},
+		t.status("Creating Jira issue for '%s'", task.Text)
+		t.useProfile(task)
+		return t.apply(change{
+			task: task,
+			remote: func() error {
+				if err := t.createJira(task); err != nil {
+					return err
+				}
+				if err := t.postItems(task, t.noteItems(task), false); err != nil {
+					return err
+				}
+				return t.postItems(task, t.worklogItems(task), false)
 			},
-		}
-		t.createJira(issue, task)
+			local:    func() error { return t.Store.Update(task) },
+			rollback: func() error { return t.deleteIssue(task) },
+			queue:    func() []*outbox.Op { return createOps(task) },
+			done:     func() string { return fmt.Sprintf("Jira issue %s was created", task.JiraKey) },
+			repair: fmt.Sprintf(
+				"Delete the Jira issue and run 'todo toggle %d' again.", task.ID),
+			entry: entry,
+		})
 	default:
-		fmt.Printf("Taking todo '%s' offline\n", task.Text)
+		t.status("Taking todo '%s' offline", task.Text)
 		task.JiraID = ""
 		task.JiraKey = ""
+		task.Profile = ""
+		task.Project = ""
+		for i := range task.Notes {
+			task.Notes[i].CommentID = ""
+		}
+		for i := range task.TimeEntries {
+			task.TimeEntries[i].WorklogID = ""
+		}
+		return t.apply(change{
+			task:  task,
+			local: func() error { return t.Store.Update(task) },
+			entry: entry,
+		})
 	}
-	config.Write(viper.ConfigFileUsed(), &t.Config)
-
-	return nil
 }
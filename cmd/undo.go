@@ -0,0 +1,228 @@
+// Copyright © 2018 Alexander Rickardsson <alex@rickardsson.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"jira"
+	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/outbox"
+
+	"github.com/spf13/cobra"
+)
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Args:  cobra.NoArgs,
+	Short: "Undoes the last change to your todo list",
+	Long: `Undoes the last add, complete, oops, toggle, edit or del. Jira is changed back
+as well, e.g. a deleted issue is created again and a closed issue is
+re-opened. Run it several times to undo several changes`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return t.Undo()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+}
+
+// Undo the last change recorded in the journal
+func (t *Todo) Undo() error {
+	if t.Journal == nil {
+		return fmt.Errorf("No journal available, nothing to undo")
+	}
+	e, err := t.Journal.Undoable()
+	if err != nil {
+		return fmt.Errorf("Unable to read journal: %v", err)
+	}
+	if e == nil {
+		return fmt.Errorf("Nothing to undo")
+	}
+	t.status("Undoing %s of task %d", e.Op, e.TaskID())
+	return t.revert(e, true)
+}
+
+// revert moves the tasks of e back to their state before e when undo is
+// set, or to their state after e otherwise. The changes e made to other
+// tasks are undone first and redone last, and the whole is recorded once
+func (t *Todo) revert(e *journal.Entry, undo bool) error {
+	entry := &journal.Entry{Op: "redo", Redo: e.Seq}
+	parts := append([]*journal.Entry{e}, e.Also...)
+	if undo {
+		entry = &journal.Entry{Op: "undo", Undo: e.Seq}
+		for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+	}
+	for i, part := range parts {
+		var record *journal.Entry
+		if i == len(parts)-1 {
+			record = entry
+		}
+		if err := t.revertTask(part, undo, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revertTask moves the task of e back to its state before e when undo is
+// set, or to its state after e otherwise. Jira is changed to match. entry
+// is recorded in the journal unless it's nil
+func (t *Todo) revertTask(e *journal.Entry, undo bool, entry *journal.Entry) error {
+	to := e.After
+	if undo {
+		to = e.Before
+	}
+	current, err := t.taskByID(e.TaskID())
+	if err != nil {
+		return err
+	}
+	switch {
+	case current == nil && to == nil:
+		return fmt.Errorf("Task %d is already deleted", e.TaskID())
+	case current == nil && to != nil && (e.Before != nil && e.After != nil):
+		return fmt.Errorf("Task %d no longer exists", e.TaskID())
+	case current != nil && (e.Before == nil || e.After == nil) && to != nil:
+		return fmt.Errorf("Task %d already exists", e.TaskID())
+	}
+
+	var target *config.Task
+	if to != nil {
+		target = to.Clone()
+		linkChanged := e.Before == nil || e.After == nil || e.Before.JiraID != e.After.JiraID
+		if current != nil && !linkChanged {
+			// The issue may have been re-created since e was recorded
+			target.JiraID = current.JiraID
+			target.JiraKey = current.JiraKey
+		}
+		if current != nil {
+			// Notes and time are not undone, they may be in Jira already
+			target.Notes = append([]config.Note(nil), current.Notes...)
+			target.TimeEntries = append([]config.TimeEntry(nil), current.TimeEntries...)
+		}
+	}
+
+	// created is set if e created the Jira issue and deleted if it removed
+	// it. Going back over such an entry has to do the opposite in Jira
+	created := (e.Before == nil || e.Before.JiraID == "") && e.After != nil && e.After.JiraID != ""
+	deleted := e.After == nil && e.Before.JiraID != ""
+	createIssue := (undo && deleted) || (!undo && created)
+	deleteIssue := (undo && created) || (!undo && deleted)
+
+	op := "redo"
+	if undo {
+		op = "undo"
+	}
+	c := change{task: target, entry: entry}
+	if current != nil && entry != nil {
+		entry.Before = current.Clone()
+	}
+	switch {
+	case target == nil:
+		c.task = current
+		c.deleted = true
+		c.local = func() error { return t.Store.Delete(current.ID) }
+	case current == nil:
+		c.local = func() error { return t.Store.Add(target) }
+	default:
+		c.local = func() error { return t.Store.Update(target) }
+	}
+
+	switch {
+	case createIssue:
+		// The old issue is gone, the task is linked to the new one once it
+		// is created
+		target.JiraID = ""
+		target.JiraKey = ""
+		c.remote = func() error {
+			if err := t.createJira(target); err != nil {
+				return err
+			}
+			if target.Done {
+				return t.transition(target, true)
+			}
+			return nil
+		}
+		c.rollback = func() error { return t.deleteIssue(target) }
+		c.queue = func() []*outbox.Op { return createOps(target) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was created", target.JiraKey) }
+		c.repair = fmt.Sprintf("Delete the Jira issue and run 'todo %s' again.", op)
+	case deleteIssue && current.JiraID != "":
+		c.remote = func() error {
+			if err := t.deleteIssue(current); err != nil {
+				return fmt.Errorf("Unable to delete Jira issue: %w", err)
+			}
+			return nil
+		}
+		c.queue = func() []*outbox.Op { return deleteOps(current) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was deleted", current.JiraKey) }
+		c.repair = fmt.Sprintf(
+			"Run 'todo toggle %d' to unlink the task and then 'todo %s' again.", current.ID, op)
+	case current != nil && target != nil && target.JiraID != "" &&
+		(current.Done != target.Done || len(jiraChanges(current, target)) > 0):
+		c.remote = func() error { return t.updateJira(current, target) }
+		c.rollback = func() error { return t.updateJira(target, current) }
+		c.queue = func() []*outbox.Op { return updateOps(current, target) }
+		c.done = func() string { return fmt.Sprintf("Jira issue %s was changed", target.JiraKey) }
+		c.repair = fmt.Sprintf(
+			"Change %s back in Jira and run 'todo %s' again.", target.JiraKey, op)
+	}
+	return t.apply(c)
+}
+
+// transition the Jira issue of task to the done or the re-open status of
+// its project. Without one any status of the done or the new category will do
+func (t *Todo) transition(task *config.Task, done bool) error {
+	jc, j, err := t.jiraFor(task)
+	if err != nil {
+		return err
+	}
+	status, legacy, category, msg := j.Project.ReopenStatus, j.Project.BacklogID, jira.StatusNew, "Re-opened by Todo"
+	if done {
+		status, legacy, category, msg = j.Project.DoneStatus, j.Project.DoneID, jira.StatusDone, "Closed by Todo"
+	}
+	if status == (config.Status{}) && legacy != "" {
+		// Set up before statuses were stored
+		err = jc.ChangeIssueStatusContext(t.ctx(), task.JiraID, legacy, msg)
+	} else {
+		if status.Category == "" {
+			status.Category = category
+		}
+		target := jira.Target{StatusID: status.ID, Category: status.Category, Name: status.Name}
+		err = jc.MoveIssueContext(t.ctx(), task.JiraID, target, msg)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to change Jira status: %w", err)
+	}
+	return nil
+}
+
+// taskByID returns the task with the supplied ID, or nil if there is none
+func (t *Todo) taskByID(id int) (*config.Task, error) {
+	tasks, err := t.Store.Tasks()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read tasks: %v", err)
+	}
+	for _, task := range tasks {
+		if task.ID == id {
+			return task, nil
+		}
+	}
+	return nil, nil
+}
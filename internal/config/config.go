@@ -2,7 +2,6 @@ package config
 
 import (
 	"io/ioutil"
-	"os"
 	"strings"
 	"time"
 
@@ -11,36 +10,167 @@ import (
 
 // Cfg contains the whole yaml config
 type Cfg struct {
-	Tasks []*Task `yaml:"tasks"`
-	Jira  Jira    `yaml:"jira"`
+	Tasks  []*Task `yaml:"tasks"`
+	NextID int     `yaml:"next_id,omitempty"`
+	Jira   Jira    `yaml:"jira"`
+	Store  Store   `yaml:"store,omitempty"`
+	// Filters are the saved filters for todo list, by name
+	Filters map[string]string `yaml:"filters,omitempty"`
+	// Profile is the profile used when --profile isn't given. Empty is the
+	// default profile, kept in Jira
+	Profile string `yaml:"profile,omitempty"`
+	// Profiles are the other Jira settings, by name
+	Profiles map[string]*Jira `yaml:"profiles,omitempty"`
+}
+
+// Store contains the task storage backend settings
+type Store struct {
+	Type string `yaml:"type"`
+	Path string `yaml:"path"`
 }
 
 // Jira contains the Jira config
 type Jira struct {
-	URL     string  `yaml:"url"`
+	URL string `yaml:"url"`
+	// Auth is how todo authenticates, one of the Auth constants. Empty
+	// means AuthOAuth1
+	Auth string `yaml:"auth,omitempty"`
+	// User is the email of the account for AuthBasic
+	User string `yaml:"user,omitempty"`
+	// Token is the encrypted OAuth access token, API token or personal
+	// access token
 	Token   string  `yaml:"token"`
 	Session string  `yaml:"session"`
 	Project Project `yaml:"project"`
 }
 
+// Ways to authenticate against Jira
+const (
+	// AuthOAuth1 uses an application link and the RSA key it was set up with
+	AuthOAuth1 = "oauth1"
+	// AuthBasic uses an email and an API token, for Jira Cloud
+	AuthBasic = "basic"
+	// AuthPAT uses a personal access token, for Jira Server and Data Center
+	AuthPAT = "pat"
+)
+
 // Project contains the active project the user has chosen
 type Project struct {
-	Name      string `yaml:"name"`
-	DoneID    string `yaml:"done_id"`
-	BacklogID string `yaml:"backlog_id"`
-	IssueType string `yaml:issue_type"`
+	Name string `yaml:"name"`
+	// DoneStatus and ReopenStatus are where completed and re-opened issues
+	// are moved to
+	DoneStatus   Status `yaml:"done_status,omitempty"`
+	ReopenStatus Status `yaml:"reopen_status,omitempty"`
+	// DoneID and BacklogID are the transitions used before statuses were
+	// stored. They are only used without DoneStatus and ReopenStatus
+	DoneID    string `yaml:"done_id,omitempty"`
+	BacklogID string `yaml:"backlog_id,omitempty"`
+	IssueType string `yaml:"issuetype"`
 	ID        string `yaml:"id"`
 	Key       string `yaml:"key"`
 }
 
+// Status is a workflow status. Without an ID it is any status of Category
+type Status struct {
+	ID       string `yaml:"id,omitempty"`
+	Name     string `yaml:"name,omitempty"`
+	Category string `yaml:"category,omitempty"`
+}
+
 // Task defines a todo task
 type Task struct {
-	Text      string    `yaml:"text"`
-	JiraID    string    `yaml:"jira_id"`
-	JiraKey   string    `yaml:"jira_key"`
-	Done      bool      `yaml:"done"`
-	Created   time.Time `yaml:"created"`
-	Completed time.Time `yaml:"completed"`
+	ID        int       `yaml:"id" json:"id"`
+	Text      string    `yaml:"text" json:"text"`
+	JiraID    string    `yaml:"jira_id" json:"jira_id"`
+	JiraKey   string    `yaml:"jira_key" json:"jira_key"`
+	Done      bool      `yaml:"done" json:"done"`
+	Created   time.Time `yaml:"created" json:"created"`
+	Completed time.Time `yaml:"completed" json:"completed"`
+	Due       time.Time `yaml:"due,omitempty" json:"due,omitempty"`
+	Start     time.Time `yaml:"start,omitempty" json:"start,omitempty"`
+	Priority  string    `yaml:"priority,omitempty" json:"priority,omitempty"`
+	Tags      []string  `yaml:"tags,omitempty" json:"tags,omitempty"`
+	// Profile and Project are the profile and the key of the project of
+	// the Jira issue. An empty Profile is the default profile
+	Profile string `yaml:"profile,omitempty" json:"profile,omitempty"`
+	Project string `yaml:"project,omitempty" json:"project,omitempty"`
+	Notes   []Note `yaml:"notes,omitempty" json:"notes,omitempty"`
+	// TimeEntries is the time spent on the task, oldest first
+	TimeEntries []TimeEntry `yaml:"time_entries,omitempty" json:"time_entries,omitempty"`
+	// Recur is set on a recurring task
+	Recur *Recurrence `yaml:"recur,omitempty" json:"recur,omitempty"`
+}
+
+// Recurrence makes a task come back when it is completed. Rule is an RRULE
+// like "FREQ=WEEKLY;BYDAY=FR". A linked task gets a new Jira issue for
+// every occurrence, unless Reopen is set and its issue is re-opened instead
+type Recurrence struct {
+	Rule   string `yaml:"rule" json:"rule"`
+	Reopen bool   `yaml:"reopen,omitempty" json:"reopen,omitempty"`
+}
+
+// Note is a timestamped note on a task. CommentID is the Jira comment it is
+// mirrored as, empty until the comment is added
+type Note struct {
+	Time      time.Time `yaml:"time" json:"time"`
+	Text      string    `yaml:"text" json:"text"`
+	CommentID string    `yaml:"comment_id,omitempty" json:"comment_id,omitempty"`
+}
+
+// TimeEntry is time spent on a task. A running timer has no End. WorklogID
+// is the Jira worklog the entry is posted as, empty until it is posted
+type TimeEntry struct {
+	Start     time.Time `yaml:"start" json:"start"`
+	End       time.Time `yaml:"end,omitempty" json:"end,omitempty"`
+	Message   string    `yaml:"message,omitempty" json:"message,omitempty"`
+	WorklogID string    `yaml:"worklog_id,omitempty" json:"worklog_id,omitempty"`
+}
+
+// Running reports whether the entry is a timer that hasn't been stopped
+func (e TimeEntry) Running() bool {
+	return e.End.IsZero()
+}
+
+// Duration is the time spent, up to now for a running timer
+func (e TimeEntry) Duration(now time.Time) time.Duration {
+	if e.Running() {
+		return now.Sub(e.Start)
+	}
+	return e.End.Sub(e.Start)
+}
+
+// Timer returns the index of the running timer of the task, -1 if there
+// is none
+func (t *Task) Timer() int {
+	for i, e := range t.TimeEntries {
+		if e.Running() {
+			return i
+		}
+	}
+	return -1
+}
+
+// Clone returns a copy of the task that shares no memory with it
+func (t *Task) Clone() *Task {
+	c := *t
+	c.Tags = append([]string(nil), t.Tags...)
+	c.Notes = append([]Note(nil), t.Notes...)
+	c.TimeEntries = append([]TimeEntry(nil), t.TimeEntries...)
+	if t.Recur != nil {
+		r := *t.Recur
+		c.Recur = &r
+	}
+	return &c
+}
+
+// HasTag reports whether the task is tagged with tag
+func (t *Task) HasTag(tag string) bool {
+	for _, tt := range t.Tags {
+		if strings.EqualFold(tt, tag) {
+			return true
+		}
+	}
+	return false
 }
 
 // Read supplied yaml file and parse to Cfg
@@ -57,23 +187,12 @@ func Read(path string) (*Cfg, error) {
 	return &cfg, nil
 }
 
-// Write supplied cfg to the yaml file
+// Write supplied cfg to the yaml file. The file is replaced atomically but
+// not locked, use Open for read-modify-write cycles
 func Write(path string, cfg interface{}) error {
 	b, err := yaml.Marshal(cfg)
 	if err != nil {
 		return err
 	}
-	dPath := strings.Split(path, "/")
-	if len(dPath) > 0 {
-		err = os.MkdirAll(strings.Join(dPath[0:len(dPath)-1], "/"), 0755)
-		if err != nil {
-			return err
-		}
-
-	}
-	err = ioutil.WriteFile(path, b, 0666)
-	if err != nil {
-		return err
-	}
-	return nil
+	return WriteAtomic(path, b)
 }
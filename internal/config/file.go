@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LockTimeout is how long Open waits for another todo process to release
+// the config file
+var LockTimeout = 10 * time.Second
+
+// ErrModified is returned by File.Write when the config file was changed
+// by someone else after it was read
+var ErrModified = errors.New("configuration file was modified by another process, run the command again")
+
+// File is a config file opened for a read-modify-write cycle. An advisory
+// lock is held from Open until Close so concurrent todo processes are
+// serialized
+type File struct {
+	path string
+	lock *os.File
+	sum  []byte
+}
+
+// Open locks the config file at path. The file itself does not need to
+// exist yet
+func Open(path string) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open lock file: %v", err)
+	}
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		ok, err := tryLock(lock)
+		if err != nil {
+			lock.Close()
+			return nil, fmt.Errorf("Unable to lock %s: %v", path, err)
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			lock.Close()
+			return nil, fmt.Errorf("Timed out waiting for another todo process to release %s", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return &File{path: path, lock: lock}, nil
+}
+
+// Path returns the path of the config file
+func (f *File) Path() string {
+	return f.path
+}
+
+// Read and parse the config file. A missing file gives an empty Cfg
+func (f *File) Read() (*Cfg, error) {
+	var cfg Cfg
+	b, err := ioutil.ReadFile(f.path)
+	switch {
+	case os.IsNotExist(err):
+		f.sum = checksum(nil)
+		return &cfg, nil
+	case err != nil:
+		return nil, err
+	}
+	f.sum = checksum(b)
+	if err = yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Write cfg to the config file. It fails with ErrModified if the file no
+// longer matches what Read returned
+func (f *File) Write(cfg interface{}) error {
+	if f.sum != nil {
+		b, err := ioutil.ReadFile(f.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if !bytes.Equal(checksum(b), f.sum) {
+			return ErrModified
+		}
+	}
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err = WriteAtomic(f.path, b); err != nil {
+		return err
+	}
+	f.sum = checksum(b)
+	return nil
+}
+
+// Close releases the lock
+func (f *File) Close() error {
+	unlock(f.lock)
+	return f.lock.Close()
+}
+
+func checksum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// WriteAtomic writes b to a temporary file next to path and renames it over
+// path, so a crash never leaves a half written file behind
+func WriteAtomic(path string, b []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
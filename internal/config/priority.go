@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Priorities are the task priorities from highest to lowest. They are the
+// default Jira priority names so they can be synced as is
+var Priorities = []string{"Highest", "High", "Medium", "Low", "Lowest"}
+
+var priorityAliases = map[string]string{
+	"a": "Highest", "1": "Highest",
+	"b": "High", "2": "High", "h": "High",
+	"c": "Medium", "3": "Medium", "m": "Medium", "med": "Medium", "normal": "Medium",
+	"d": "Low", "4": "Low", "l": "Low",
+	"e": "Lowest", "5": "Lowest",
+}
+
+// ParsePriority returns the priority name for s. Apart from the names in
+// Priorities it accepts A-E, 1-5 and an optional leading '!'. An empty
+// string means no priority
+func ParsePriority(s string) (string, error) {
+	s = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "!"))
+	if s == "" || s == "none" {
+		return "", nil
+	}
+	for _, p := range Priorities {
+		if strings.ToLower(p) == s {
+			return p, nil
+		}
+	}
+	if p, ok := priorityAliases[s]; ok {
+		return p, nil
+	}
+	return "", fmt.Errorf("Invalid priority '%s'. Valid options are: %s or A-E",
+		s, strings.Join(Priorities, ", "))
+}
+
+// PriorityRank returns 1 for the highest priority and len(Priorities) for
+// the lowest. Tasks without a priority rank as Medium
+func PriorityRank(p string) int {
+	for i, name := range Priorities {
+		if name == p {
+			return i + 1
+		}
+	}
+	return 3
+}
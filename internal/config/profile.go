@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultProfile is the name of the profile kept in Cfg.Jira
+const DefaultProfile = "default"
+
+// ProfileName returns how tasks and Cfg.Profile refer to the profile name,
+// which is empty for the default profile
+func ProfileName(name string) string {
+	if name == DefaultProfile {
+		return ""
+	}
+	return name
+}
+
+// JiraProfile returns the Jira settings of the named profile
+func (c *Cfg) JiraProfile(name string) (*Jira, error) {
+	if ProfileName(name) == "" {
+		return &c.Jira, nil
+	}
+	j, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("No profile named '%s'", name)
+	}
+	return j, nil
+}
+
+// ProfileNames returns the names of the profiles, the default one first if
+// it is set up
+func (c *Cfg) ProfileNames() []string {
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if c.Jira.URL != "" {
+		names = append([]string{DefaultProfile}, names...)
+	}
+	return names
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -9,15 +11,20 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 // ReadRSAKey will parse the supplied path and return an RSA Key
 func ReadRSAKey(path string) (*rsa.PrivateKey, error) {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to open private key file: %v", err)
+		return nil, fmt.Errorf("Unable to open private key file: %w", err)
 	}
 	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("Unable to parse private key: %s is not a PEM file", path)
+	}
 	privKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to parse private key: %v", err)
@@ -25,37 +32,99 @@ func ReadRSAKey(path string) (*rsa.PrivateKey, error) {
 	return privKey, nil
 }
 
-// Encrypt a Base64 encoded message with the supplied public key
+// GenerateRSAKey creates a new private key and saves it to path, readable
+// by the user only
+func GenerateRSAKey(path string) (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	b := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return nil, fmt.Errorf("Unable to save private key: %v", err)
+	}
+	return key, nil
+}
+
+// Encrypt a message with the supplied public key and Base64 encode it. The
+// message is encrypted with a new AES-GCM key, which is encrypted with the
+// public key in front of it, so the length of the message isn't limited by
+// the size of the key
 func Encrypt(pubKey *rsa.PublicKey, message string) (string, error) {
-	encrypted, err := rsa.EncryptOAEP(
-		sha1.New(),
-		rand.Reader,
-		pubKey,
-		[]byte(message),
-		[]byte("todo"),
-	)
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	encKey, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pubKey, key, []byte("todo"))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
 	if err != nil {
 		return "", err
 	}
-	strEnc := base64.StdEncoding.EncodeToString(encrypted)
-	return strEnc, nil
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	encrypted := gcm.Seal(append(encKey, nonce...), nonce, []byte(message), nil)
+	return base64.StdEncoding.EncodeToString(encrypted), nil
 }
 
-// Decrypt a Base64 encoded message with the supplied private key
+// Decrypt a Base64 encoded message with the supplied private key. Messages
+// encrypted with the key alone, as before Encrypt used AES-GCM, are the
+// size of the key and are still read
 func Decrypt(privKey *rsa.PrivateKey, message string) (string, error) {
 	bytesEnc, err := base64.StdEncoding.DecodeString(message)
 	if err != nil {
 		return "", fmt.Errorf("Unbable to decode base64 string: %v", err)
 	}
-	decrypted, err := rsa.DecryptOAEP(
-		sha1.New(),
-		rand.Reader,
-		privKey,
-		bytesEnc,
-		[]byte("todo"),
-	)
+	size := privKey.Size()
+	if len(bytesEnc) == size {
+		decrypted, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, privKey, bytesEnc, []byte("todo"))
+		if err != nil {
+			return "", fmt.Errorf("Unable to rsa decrypt: %v", err)
+		}
+		return string(decrypted), nil
+	}
+	if len(bytesEnc) < size {
+		return "", fmt.Errorf("Unable to decrypt: the message is too short")
+	}
+	key, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, privKey, bytesEnc[:size], []byte("todo"))
 	if err != nil {
 		return "", fmt.Errorf("Unable to rsa decrypt: %v", err)
 	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	rest := bytesEnc[size:]
+	if len(rest) < gcm.NonceSize() {
+		return "", fmt.Errorf("Unable to decrypt: the message is too short")
+	}
+	decrypted, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("Unable to decrypt: %v", err)
+	}
 	return string(decrypted), nil
 }
+
+// CheckKey reports a public key that tokens can't be encrypted with, so
+// it's found before the user is asked for a token
+func CheckKey(pubKey *rsa.PublicKey) error {
+	if _, err := Encrypt(pubKey, ""); err != nil {
+		return fmt.Errorf("Unable to encrypt tokens with the private key: %v", err)
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,72 @@
+// Package issuecache keeps the Jira issues of linked tasks as they were
+// last fetched, so todo show can show them while Jira can't be reached
+package issuecache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"jira"
+	"os"
+	"time"
+	"todo/internal/config"
+)
+
+// Entry is an issue and when it was fetched
+type Entry struct {
+	Issue *jira.Issue `json:"issue"`
+	Time  time.Time   `json:"time"`
+}
+
+// Cache holds the entries by task ID, saved as JSON
+type Cache struct {
+	path    string
+	entries map[int]Entry
+}
+
+// Open the cache at path. A missing file is an empty cache
+func Open(path string) (*Cache, error) {
+	c := &Cache{path: path, entries: map[int]Entry{}}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &c.entries); err != nil {
+		return nil, err
+	}
+	if c.entries == nil {
+		c.entries = map[int]Entry{}
+	}
+	return c, nil
+}
+
+// Get the issue of the task with the supplied ID
+func (c *Cache) Get(id int) (Entry, bool) {
+	e, ok := c.entries[id]
+	return e, ok
+}
+
+// Set the issue of the task with the supplied ID, fetched now, and save
+func (c *Cache) Set(id int, issue *jira.Issue) error {
+	c.entries[id] = Entry{Issue: issue, Time: time.Now()}
+	return c.save()
+}
+
+// Delete the issue of the task with the supplied ID and save
+func (c *Cache) Delete(id int) error {
+	if _, ok := c.entries[id]; !ok {
+		return nil
+	}
+	delete(c.entries, id)
+	return c.save()
+}
+
+func (c *Cache) save() error {
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteAtomic(c.path, b)
+}
@@ -0,0 +1,153 @@
+// Package journal records every change made to the todo list so it can be
+// undone and redone
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+	"todo/internal/config"
+)
+
+// Entry is one change to a task. Before is nil for added tasks and After is
+// nil for deleted ones. Undo and redo are recorded as entries of their own
+// pointing to the entry they reverted or re-applied
+type Entry struct {
+	Seq    int          `json:"seq"`
+	Time   time.Time    `json:"time"`
+	Op     string       `json:"op"`
+	Before *config.Task `json:"before,omitempty"`
+	After  *config.Task `json:"after,omitempty"`
+	Undo   int          `json:"undo,omitempty"`
+	Redo   int          `json:"redo,omitempty"`
+	// Also are changes to other tasks made by the same command, like the
+	// next occurrence added when a recurring task is completed. They are
+	// undone and redone together with the entry
+	Also []*Entry `json:"also,omitempty"`
+}
+
+// TaskID returns the ID of the task the entry changed
+func (e *Entry) TaskID() int {
+	if e.After != nil {
+		return e.After.ID
+	}
+	return e.Before.ID
+}
+
+// Journal is an append-only file of entries, one JSON object per line
+type Journal struct {
+	path string
+}
+
+// Open the journal at path. The file is created on the first Append
+func Open(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Entries returns every entry in the journal. A partially written last
+// line, left by a crash, is ignored
+func (j *Journal) Entries() ([]*Entry, error) {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []*Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		e := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Append e to the journal and give it the next sequence number
+func (j *Journal) Append(e *Entry) error {
+	entries, err := j.Entries()
+	if err != nil {
+		return err
+	}
+	e.Seq = 1
+	if len(entries) > 0 {
+		e.Seq = entries[len(entries)-1].Seq + 1
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Undoable returns the entry the next undo should revert, or nil if there
+// is nothing to undo
+func (j *Journal) Undoable() (*Entry, error) {
+	undo, _, err := j.stacks()
+	if err != nil || len(undo) == 0 {
+		return nil, err
+	}
+	return undo[len(undo)-1], nil
+}
+
+// Redoable returns the entry the next redo should re-apply, or nil if there
+// is nothing to redo
+func (j *Journal) Redoable() (*Entry, error) {
+	_, redo, err := j.stacks()
+	if err != nil || len(redo) == 0 {
+		return nil, err
+	}
+	return redo[len(redo)-1], nil
+}
+
+// stacks replays the journal into an undo and a redo stack. A new change
+// clears the redo stack like in any editor
+func (j *Journal) stacks() ([]*Entry, []*Entry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, nil, err
+	}
+	var undo, redo []*Entry
+	for _, e := range entries {
+		switch {
+		case e.Undo != 0:
+			if len(undo) == 0 || undo[len(undo)-1].Seq != e.Undo {
+				return nil, nil, fmt.Errorf("Journal entry %d undoes %d out of order", e.Seq, e.Undo)
+			}
+			redo = append(redo, undo[len(undo)-1])
+			undo = undo[:len(undo)-1]
+		case e.Redo != 0:
+			if len(redo) == 0 || redo[len(redo)-1].Seq != e.Redo {
+				return nil, nil, fmt.Errorf("Journal entry %d redoes %d out of order", e.Seq, e.Redo)
+			}
+			undo = append(undo, redo[len(redo)-1])
+			redo = redo[:len(redo)-1]
+		default:
+			undo = append(undo, e)
+			redo = nil
+		}
+	}
+	return undo, redo, nil
+}
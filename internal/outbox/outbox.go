@@ -0,0 +1,190 @@
+// Package outbox queues Jira changes that could not be made because Jira
+// was unreachable, so they can be replayed in order later
+package outbox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+	"todo/internal/config"
+)
+
+// Kinds of operations
+const (
+	// Create creates an issue for the task as it is when replayed
+	Create = "create"
+	// Update sets Fields on the issue of the task
+	Update = "update"
+	// Transition moves the issue of the task to the done or backlog status
+	Transition = "transition"
+	// Delete deletes the issue JiraID. The task is already gone
+	Delete = "delete"
+	// Comment adds the notes of the task that aren't in Jira yet as comments
+	Comment = "comment"
+	// Worklog adds the finished time entries of the task that aren't in
+	// Jira yet as worklogs
+	Worklog = "worklog"
+)
+
+// Op is one queued Jira change. Operations refer to the task by ID since
+// the task may not be linked to an issue until an earlier Create is
+// replayed
+type Op struct {
+	Seq     int       `json:"seq" yaml:"seq"`
+	Time    time.Time `json:"time" yaml:"time"`
+	Kind    string    `json:"kind" yaml:"kind"`
+	TaskID  int       `json:"task_id" yaml:"task_id"`
+	JiraID  string    `json:"jira_id,omitempty" yaml:"jira_id,omitempty"`
+	JiraKey string    `json:"jira_key,omitempty" yaml:"jira_key,omitempty"`
+	// Profile is the profile of the issue of a Delete
+	Profile string                 `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Done    bool                   `json:"done,omitempty" yaml:"done,omitempty"`
+	// Attempts is the number of failed replays, NextTry when to try again
+	Attempts int       `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	NextTry  time.Time `json:"next_try,omitempty" yaml:"next_try,omitempty"`
+	// Error is the last error. Failed is set if Jira rejected the change,
+	// retrying won't help then
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+	Failed bool   `json:"failed,omitempty" yaml:"failed,omitempty"`
+}
+
+// Outbox is the queue of operations, saved as JSON
+type Outbox struct {
+	path string
+	ops  []*Op
+}
+
+// Open the outbox at path. A missing file is an empty outbox
+func Open(path string) (*Outbox, error) {
+	o := &Outbox{path: path}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &o.ops); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Ops returns every queued operation in order, including failed ones
+func (o *Outbox) Ops() []*Op {
+	return o.ops
+}
+
+// Pending returns the operations that are still to be replayed, in order
+func (o *Outbox) Pending() []*Op {
+	var pending []*Op
+	for _, op := range o.ops {
+		if !op.Failed {
+			pending = append(pending, op)
+		}
+	}
+	return pending
+}
+
+// Add queues ops after the ones already queued. Operations on a task with a
+// queued Create are dropped since the issue is created from the task as it
+// is when replayed
+func (o *Outbox) Add(ops ...*Op) error {
+	for _, op := range ops {
+		if o.creating(op.TaskID) {
+			continue
+		}
+		op.Seq = 1
+		if len(o.ops) > 0 {
+			op.Seq = o.ops[len(o.ops)-1].Seq + 1
+		}
+		if op.Time.IsZero() {
+			op.Time = time.Now()
+		}
+		o.ops = append(o.ops, op)
+	}
+	return o.Save()
+}
+
+// Remove the operation with the supplied sequence number
+func (o *Outbox) Remove(seq int) error {
+	for i, op := range o.ops {
+		if op.Seq == seq {
+			o.ops = append(o.ops[:i], o.ops[i+1:]...)
+			break
+		}
+	}
+	return o.Save()
+}
+
+// Retry records a failed attempt to replay op. It is tried again after a
+// delay that doubles with every attempt
+func (o *Outbox) Retry(op *Op, err error) error {
+	op.Attempts++
+	op.Error = err.Error()
+	op.NextTry = time.Now().Add(Backoff(op.Attempts))
+	return o.Save()
+}
+
+// Fail marks op as rejected by Jira. It stays in the outbox, but is not
+// replayed again
+func (o *Outbox) Fail(op *Op, err error) error {
+	op.Error = err.Error()
+	op.Failed = true
+	return o.Save()
+}
+
+// Backoff returns how long to wait before the next attempt after attempts
+// failed ones. It starts at 30 seconds and doubles up to an hour
+func Backoff(attempts int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+func (o *Outbox) creating(taskID int) bool {
+	for _, op := range o.ops {
+		if op.Kind == Create && op.TaskID == taskID && !op.Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// Forget drops the queued operations on a task that was deleted. Deletes
+// are kept, the issue still has to go
+func (o *Outbox) Forget(taskID int) error {
+	var kept []*Op
+	for _, op := range o.ops {
+		if op.TaskID != taskID || op.Kind == Delete {
+			kept = append(kept, op)
+		}
+	}
+	if len(kept) == len(o.ops) {
+		return nil
+	}
+	o.ops = kept
+	return o.Save()
+}
+
+// Save the outbox. An empty outbox removes the file
+func (o *Outbox) Save() error {
+	if len(o.ops) == 0 {
+		if err := os.Remove(o.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(o.ops, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteAtomic(o.path, b)
+}
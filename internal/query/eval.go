@@ -0,0 +1,276 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"todo/internal/config"
+	"todo/internal/when"
+)
+
+type operator string
+
+const (
+	opHas   operator = ":"
+	opEq    operator = "="
+	opNe    operator = "!="
+	opLt    operator = "<"
+	opLe    operator = "<="
+	opGt    operator = ">"
+	opGe    operator = ">="
+	opMatch operator = "~"
+)
+
+var (
+	comparison = []operator{opHas, opEq, opNe, opLt, opLe, opGt, opGe}
+	matching   = []operator{opHas, opEq, opNe, opMatch}
+)
+
+// predicate is a single term of an expression
+type predicate struct {
+	text string
+	fn   func(task *config.Task) bool
+}
+
+func (p predicate) Match(task *config.Task) bool { return p.fn(task) }
+func (p predicate) String() string               { return p.text }
+
+type all struct{}
+
+func (all) Match(*config.Task) bool { return true }
+func (all) String() string          { return "all" }
+
+type and struct{ left, right Expr }
+
+func (e and) Match(task *config.Task) bool { return e.left.Match(task) && e.right.Match(task) }
+func (e and) String() string               { return fmt.Sprintf("(%s and %s)", e.left, e.right) }
+
+type or struct{ left, right Expr }
+
+func (e or) Match(task *config.Task) bool { return e.left.Match(task) || e.right.Match(task) }
+func (e or) String() string               { return fmt.Sprintf("(%s or %s)", e.left, e.right) }
+
+type not struct{ e Expr }
+
+func (e not) Match(task *config.Task) bool { return !e.e.Match(task) }
+func (e not) String() string               { return fmt.Sprintf("not %s", e.e) }
+
+// saved is an expanded saved filter
+type saved struct {
+	Expr
+	name string
+}
+
+func (e saved) String() string { return fmt.Sprintf("@%s%s", e.name, e.Expr) }
+
+// keywords are the terms that stand on their own
+var keywords = map[string]func(now time.Time) Expr{
+	"all": func(time.Time) Expr { return all{} },
+	"open": func(time.Time) Expr {
+		return predicate{"open", func(task *config.Task) bool { return !task.Done }}
+	},
+	"done": func(time.Time) Expr {
+		return predicate{"done", func(task *config.Task) bool { return task.Done }}
+	},
+	"completed": func(time.Time) Expr {
+		return predicate{"done", func(task *config.Task) bool { return task.Done }}
+	},
+	"linked": func(time.Time) Expr {
+		return predicate{"linked", func(task *config.Task) bool { return task.JiraKey != "" }}
+	},
+	"overdue": func(now time.Time) Expr {
+		return predicate{"overdue", func(task *config.Task) bool {
+			return !task.Done && !task.Due.IsZero() && task.Due.Before(now)
+		}}
+	},
+	"started": func(now time.Time) Expr {
+		return predicate{"started", func(task *config.Task) bool { return !task.Start.After(now) }}
+	},
+}
+
+// field describes a field that can be compared with a value
+type field struct {
+	operators []operator
+	build     func(op operator, value string, now time.Time) (func(task *config.Task) bool, error)
+}
+
+func (f field) allows(op operator) bool {
+	for _, o := range f.operators {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (f field) ops() []string {
+	var ops []string
+	for _, o := range f.operators {
+		ops = append(ops, string(o))
+	}
+	return ops
+}
+
+// fields maps field names, including aliases, to fields
+var fields = map[string]field{
+	"id":        {comparison, buildID},
+	"text":      {matching, buildText},
+	"tag":       {matching, buildTag},
+	"tags":      {matching, buildTag},
+	"key":       {matching, buildKey},
+	"jira":      {matching, buildKey},
+	"pri":       {comparison, buildPriority},
+	"priority":  {comparison, buildPriority},
+	"due":       {comparison, dateField(func(t *config.Task) time.Time { return t.Due })},
+	"start":     {comparison, dateField(func(t *config.Task) time.Time { return t.Start })},
+	"created":   {comparison, dateField(func(t *config.Task) time.Time { return t.Created })},
+	"completed": {comparison, dateField(func(t *config.Task) time.Time { return t.Completed })},
+}
+
+// compare builds a predicate from the result of comparing a task's field
+// with the value, -1, 0 or 1 like strings.Compare
+func compare(op operator, cmp func(task *config.Task) int) func(task *config.Task) bool {
+	return func(task *config.Task) bool {
+		c := cmp(task)
+		switch op {
+		case opLt:
+			return c < 0
+		case opLe:
+			return c <= 0
+		case opGt:
+			return c > 0
+		case opGe:
+			return c >= 0
+		case opNe:
+			return c != 0
+		}
+		return c == 0
+	}
+}
+
+func buildID(op operator, value string, _ time.Time) (func(task *config.Task) bool, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a task ID", value)
+	}
+	return compare(op, func(task *config.Task) int {
+		switch {
+		case task.ID < id:
+			return -1
+		case task.ID > id:
+			return 1
+		}
+		return 0
+	}), nil
+}
+
+func buildText(op operator, value string, _ time.Time) (func(task *config.Task) bool, error) {
+	return stringMatch(op, value, func(task *config.Task) []string { return []string{task.Text} }, true)
+}
+
+func buildTag(op operator, value string, _ time.Time) (func(task *config.Task) bool, error) {
+	return stringMatch(op, strings.TrimPrefix(value, "+"), func(task *config.Task) []string { return task.Tags }, false)
+}
+
+func buildKey(op operator, value string, _ time.Time) (func(task *config.Task) bool, error) {
+	if strings.EqualFold(value, "none") && op != opMatch {
+		return compare(op, func(task *config.Task) int {
+			if task.JiraKey == "" {
+				return 0
+			}
+			return 1
+		}), nil
+	}
+	return stringMatch(op, value, func(task *config.Task) []string { return []string{task.JiraKey} }, false)
+}
+
+// stringMatch matches value against the strings returned by get. ':' is a
+// substring match if substr is set, '~' a regular expression and '=' an
+// exact match, all case insensitive. A task matches if any string does
+func stringMatch(op operator, value string, get func(task *config.Task) []string, substr bool) (func(task *config.Task) bool, error) {
+	var match func(s string) bool
+	switch {
+	case op == opMatch:
+		re, err := regexp.Compile("(?i)" + value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s'", value)
+		}
+		match = re.MatchString
+	case op == opHas && substr:
+		value = strings.ToLower(value)
+		match = func(s string) bool { return strings.Contains(strings.ToLower(s), value) }
+	default:
+		match = func(s string) bool { return strings.EqualFold(s, value) }
+	}
+	return func(task *config.Task) bool {
+		for _, s := range get(task) {
+			if match(s) {
+				return op != opNe
+			}
+		}
+		return op == opNe
+	}, nil
+}
+
+// buildPriority compares priorities so that higher priorities are greater,
+// "pri>=high" matches High and Highest. Tasks without a priority only
+// match "pri:none"
+func buildPriority(op operator, value string, _ time.Time) (func(task *config.Task) bool, error) {
+	p, err := config.ParsePriority(value)
+	if err != nil {
+		return nil, fmt.Errorf("unknown priority '%s'", value)
+	}
+	if p == "" && op != opHas && op != opEq && op != opNe {
+		return nil, fmt.Errorf("'none' can only be used with : = !=")
+	}
+	cmp := compare(op, func(task *config.Task) int {
+		return config.PriorityRank(p) - config.PriorityRank(task.Priority)
+	})
+	return func(task *config.Task) bool {
+		if p == "" || task.Priority == "" {
+			return (task.Priority == p) != (op == opNe)
+		}
+		return cmp(task)
+	}, nil
+}
+
+// dateField compares a date field with a date accepted by when.Parse. A
+// date without a time of day stands for the whole day, so "due=fri"
+// matches anything due on Friday and "due<fri" anything due before it.
+// Tasks without the date only match "none", e.g. "due:none"
+func dateField(get func(task *config.Task) time.Time) func(operator, string, time.Time) (func(task *config.Task) bool, error) {
+	return func(op operator, value string, now time.Time) (func(task *config.Task) bool, error) {
+		if strings.EqualFold(value, "none") {
+			if op != opHas && op != opEq && op != opNe {
+				return nil, fmt.Errorf("'none' can only be used with : = !=")
+			}
+			return func(task *config.Task) bool { return get(task).IsZero() != (op == opNe) }, nil
+		}
+		from, clock, err := when.Parse(value, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date '%s'", value)
+		}
+		to := from
+		if !clock {
+			to = when.EndOfDay(from)
+		}
+		cmp := compare(op, func(task *config.Task) int {
+			d := get(task)
+			switch {
+			case d.Before(from):
+				return -1
+			case d.After(to):
+				return 1
+			}
+			return 0
+		})
+		return func(task *config.Task) bool {
+			if get(task).IsZero() {
+				return op == opNe
+			}
+			return cmp(task)
+		}, nil
+	}
+}
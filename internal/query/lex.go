@@ -0,0 +1,101 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators, longest first so "<=" is not read as "<"
+var operators = []string{"<=", ">=", "!=", "<", ">", "=", ":", "~"}
+
+// lex splits s into tokens. Words run until whitespace, a parenthesis, a
+// quote or an operator. Quoted strings may contain anything but an
+// unescaped quote
+func lex(s string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			str, n, ok := quoted(s[i:])
+			if !ok {
+				return nil, &Error{Query: s, Pos: i, Msg: "missing closing quote"}
+			}
+			tokens = append(tokens, token{tokString, str, i})
+			i += n
+		default:
+			if op := operatorAt(s[i:]); op != "" {
+				tokens = append(tokens, token{tokOp, op, i})
+				i += len(op)
+				continue
+			}
+			if c == '!' {
+				tokens = append(tokens, token{tokNot, "!", i})
+				i++
+				continue
+			}
+			start := i
+			for i < len(s) && !unicode.IsSpace(rune(s[i])) && !strings.ContainsRune("()\"'!", rune(s[i])) &&
+				operatorAt(s[i:]) == "" {
+				i++
+			}
+			tokens = append(tokens, token{tokWord, s[start:i], start})
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(s)}), nil
+}
+
+func operatorAt(s string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// quoted reads the quoted string at the start of s. It returns the string
+// without quotes and the number of bytes read
+func quoted(s string) (string, int, bool) {
+	q := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case s[i] == q:
+			return b.String(), i + 1, true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,223 @@
+// Package query parses and evaluates the filter expressions accepted by
+// todo list, e.g.
+//
+//	open and tag:backend and due<7d and text~"login"
+//
+// An expression is made of terms joined by "and", "or" and "not" and
+// grouped with parentheses. Terms are either keywords like "open" or
+// "overdue", field comparisons like "pri>=high" or "due<fri", "+tag" as
+// a short form of "tag:tag", or "@name" which refers to a saved filter
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"todo/internal/config"
+)
+
+// Expr is a parsed filter expression
+type Expr interface {
+	// Match reports whether task matches the expression
+	Match(task *config.Task) bool
+	String() string
+}
+
+// Error is a parse error at a position in the expression
+type Error struct {
+	Query string
+	// Pos is the byte offset in Query where the error was found
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Invalid filter: %s\n  %s\n  %s^", e.Msg, e.Query, strings.Repeat(" ", e.Pos))
+}
+
+// Parse the expression s. Dates in it are relative to now, and @name
+// refers to the saved filter name in filters
+func Parse(s string, now time.Time, filters map[string]string) (Expr, error) {
+	return parse(s, now, filters, nil)
+}
+
+func parse(s string, now time.Time, filters map[string]string, seen []string) (Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{query: s, tokens: tokens, now: now, filters: filters, seen: seen}
+	if p.peek().kind == tokEOF {
+		return all{}, nil
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "expected 'and', 'or' or the end of the filter, found '%s'", tok.text)
+	}
+	return e, nil
+}
+
+type parser struct {
+	query   string
+	tokens  []token
+	pos     int
+	now     time.Time
+	filters map[string]string
+	// seen are the saved filters being expanded, to detect cycles
+	seen []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// keyword reports whether the next token is the word kw, and consumes it
+// if it is
+func (p *parser) keyword(kw string) bool {
+	tok := p.peek()
+	if tok.kind == tokWord && strings.EqualFold(tok.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return &Error{Query: p.query, Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// or := and ("or" and)*
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+	return left, nil
+}
+
+// and := not ("and" not)*
+func (p *parser) and() (Expr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+	return left, nil
+}
+
+// not := ("not" | "!") not | term
+func (p *parser) not() (Expr, error) {
+	if tok := p.peek(); tok.kind == tokNot || tok.kind == tokWord && strings.EqualFold(tok.text, "not") {
+		p.next()
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return not{e}, nil
+	}
+	return p.term()
+}
+
+// term := "(" or ")" | "@" name | "+" tag | keyword | field op value
+func (p *parser) term() (Expr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if end := p.next(); end.kind != tokRParen {
+			return nil, p.errorf(end, "expected ')' to close the '(' at position %d", tok.pos+1)
+		}
+		return e, nil
+	case tokEOF:
+		return nil, p.errorf(tok, "unexpected end of filter, expected a term")
+	case tokWord:
+	default:
+		return nil, p.errorf(tok, "unexpected '%s', expected a term", tok.text)
+	}
+
+	word := tok.text
+	switch {
+	case strings.HasPrefix(word, "@"):
+		return p.saved(tok)
+	case strings.HasPrefix(word, "+") && len(word) > 1:
+		fn, _ := buildTag(opHas, word[1:], p.now)
+		return predicate{"tag:" + word[1:], fn}, nil
+	}
+	if p.peek().kind != tokOp {
+		if k, ok := keywords[strings.ToLower(word)]; ok {
+			return k(p.now), nil
+		}
+		if _, ok := fields[strings.ToLower(word)]; ok {
+			return nil, p.errorf(p.peek(), "expected an operator after '%s'", word)
+		}
+		return nil, p.errorf(tok, "unknown keyword '%s'", word)
+	}
+	field, ok := fields[strings.ToLower(word)]
+	if !ok {
+		return nil, p.errorf(tok, "unknown field '%s'", word)
+	}
+	opTok := p.next()
+	op := operator(opTok.text)
+	if !field.allows(op) {
+		return nil, p.errorf(opTok, "operator '%s' can't be used with %s, use one of %s",
+			opTok.text, word, strings.Join(field.ops(), " "))
+	}
+	value := p.next()
+	if value.kind != tokWord && value.kind != tokString {
+		return nil, p.errorf(value, "expected a value after '%s%s'", word, opTok.text)
+	}
+	fn, err := field.build(op, value.text, p.now)
+	if err != nil {
+		return nil, p.errorf(value, "%v", err)
+	}
+	return predicate{fmt.Sprintf("%s%s%q", strings.ToLower(word), op, value.text), fn}, nil
+}
+
+// saved expands the saved filter named by tok
+func (p *parser) saved(tok token) (Expr, error) {
+	name := strings.ToLower(tok.text[1:])
+	s, ok := p.filters[name]
+	if !ok {
+		return nil, p.errorf(tok, "no saved filter named '%s'", name)
+	}
+	for _, n := range p.seen {
+		if n == name {
+			return nil, p.errorf(tok, "saved filter '%s' refers to itself", name)
+		}
+	}
+	e, err := parse(s, p.now, p.filters, append(p.seen, name))
+	if err != nil {
+		if perr, ok := err.(*Error); ok {
+			perr.Msg = fmt.Sprintf("in saved filter '%s': %s", name, perr.Msg)
+		}
+		return nil, err
+	}
+	return saved{name: name, Expr: e}, nil
+}
@@ -0,0 +1,302 @@
+// Package recur parses the rules of recurring tasks and finds their next
+// occurrence. Rules are a subset of the iCalendar RRULE, e.g.
+// "FREQ=WEEKLY;BYDAY=FR", or shorthands like "fri", "mon,wed", "weekdays",
+// "daily", "2w" or "15th"
+package recur
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"todo/internal/when"
+)
+
+// Freq is how often a rule repeats
+type Freq string
+
+// The frequencies of RRULE that are supported
+const (
+	Daily   Freq = "DAILY"
+	Weekly  Freq = "WEEKLY"
+	Monthly Freq = "MONTHLY"
+	Yearly  Freq = "YEARLY"
+)
+
+// LastDay is the ByMonthDay of a rule repeating on the last day of the month
+const LastDay = -1
+
+var (
+	interval = regexp.MustCompile(`^(\d*)\s*(d|days?|w|weeks?|m|months?|y|years?)$`)
+	monthDay = regexp.MustCompile(`^(\d{1,2})(st|nd|rd|th)?$`)
+	units    = map[byte]Freq{'d': Daily, 'w': Weekly, 'm': Monthly, 'y': Yearly}
+	names    = map[string]Freq{
+		"daily": Daily, "weekly": Weekly, "monthly": Monthly, "yearly": Yearly, "annually": Yearly,
+	}
+	days = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+)
+
+// Rule is when a task recurs. ByDay is only used with Weekly and
+// ByMonthDay, a day of the month or LastDay, with Monthly, or with Yearly
+// together with ByMonth
+type Rule struct {
+	Freq       Freq
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonth    time.Month
+	ByMonthDay int
+}
+
+// Parse a rule. s is either an RRULE with FREQ and optionally INTERVAL,
+// BYDAY, BYMONTH and BYMONTHDAY, or one of the shorthands "daily", "weekly",
+// "monthly", "yearly", "weekdays", an interval like "2w" or "3 days",
+// weekday names like "fri" or "mon,wed", or a day of the month like "1st",
+// "15th" or "last"
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("Empty rule")
+	}
+	if strings.Contains(s, "=") {
+		return parseRRule(s)
+	}
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	r := &Rule{Interval: 1}
+	if f, ok := names[s]; ok {
+		r.Freq = f
+		return r, nil
+	}
+	if m := interval.FindStringSubmatch(s); m != nil {
+		r.Freq = units[m[2][0]]
+		if m[1] != "" {
+			r.Interval, _ = strconv.Atoi(m[1])
+		}
+		return r, r.check()
+	}
+	if m := monthDay.FindStringSubmatch(s); m != nil || s == "last" {
+		r.Freq, r.ByMonthDay = Monthly, LastDay
+		if m != nil {
+			r.ByMonthDay, _ = strconv.Atoi(m[1])
+		}
+		return r, r.check()
+	}
+	r.Freq = Weekly
+	if s == "weekdays" {
+		r.ByDay = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+		return r, nil
+	}
+	for _, name := range strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ' ' }) {
+		wd, ok := when.Weekday(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown rule '%s'", s)
+		}
+		r.ByDay = append(r.ByDay, wd)
+	}
+	return r, r.check()
+}
+
+// parseRRule parses s as an RRULE, with or without the "RRULE:" prefix
+func parseRRule(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.ReplaceAll(s, " ", "")), "RRULE:")
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(strings.Trim(s, ";"), ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid rule part '%s'", part)
+		}
+		var err error
+		switch kv[0] {
+		case "FREQ":
+			r.Freq = Freq(kv[1])
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(kv[1])
+		case "BYMONTH":
+			var m int
+			m, err = strconv.Atoi(kv[1])
+			r.ByMonth = time.Month(m)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = strconv.Atoi(kv[1])
+		case "BYDAY":
+			for _, d := range strings.Split(kv[1], ",") {
+				wd := index(days, d)
+				if wd < 0 {
+					return nil, fmt.Errorf("Unsupported day '%s'", d)
+				}
+				r.ByDay = append(r.ByDay, time.Weekday(wd))
+			}
+		default:
+			return nil, fmt.Errorf("Unsupported rule part '%s'", kv[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %v", kv[0], err)
+		}
+	}
+	return r, r.check()
+}
+
+// check reports rules that Next can't follow
+func (r *Rule) check() error {
+	switch {
+	case r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly && r.Freq != Yearly:
+		return fmt.Errorf("Unsupported frequency '%s'", r.Freq)
+	case r.Interval < 1:
+		return fmt.Errorf("The interval must be at least 1")
+	case len(r.ByDay) > 0 && r.Freq != Weekly:
+		return fmt.Errorf("Days of the week can only be given for weekly rules")
+	case r.ByMonth != 0 && r.Freq != Yearly:
+		return fmt.Errorf("A month can only be given for yearly rules")
+	case r.ByMonthDay != 0 && r.Freq != Monthly && r.Freq != Yearly:
+		return fmt.Errorf("A day of the month can only be given for monthly and yearly rules")
+	case r.Freq == Yearly && (r.ByMonth == 0) != (r.ByMonthDay == 0):
+		return fmt.Errorf("Yearly rules need both a month and a day of the month, or neither")
+	case r.ByMonth < 0 || r.ByMonth > 12:
+		return fmt.Errorf("Invalid month %d", r.ByMonth)
+	case r.ByMonthDay < LastDay || r.ByMonthDay > 31:
+		return fmt.Errorf("Invalid day of the month %d", r.ByMonthDay)
+	}
+	return nil
+}
+
+// String returns the rule as an RRULE
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		var by []string
+		for _, wd := range r.ByDay {
+			by = append(by, days[wd])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(by, ","))
+	}
+	if r.ByMonth != 0 {
+		parts = append(parts, fmt.Sprintf("BYMONTH=%d", r.ByMonth))
+	}
+	if r.ByMonthDay != 0 {
+		parts = append(parts, fmt.Sprintf("BYMONTHDAY=%d", r.ByMonthDay))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Describe returns the rule in words, e.g. "every 2 weeks on Friday"
+func (r *Rule) Describe() string {
+	unit := map[Freq]string{Daily: "day", Weekly: "week", Monthly: "month", Yearly: "year"}[r.Freq]
+	s := "every " + unit
+	if r.Interval > 1 {
+		s = fmt.Sprintf("every %d %ss", r.Interval, unit)
+	}
+	if len(r.ByDay) > 0 {
+		var names []string
+		for _, wd := range r.ByDay {
+			names = append(names, wd.String())
+		}
+		s += " on " + strings.Join(names, ", ")
+	}
+	switch {
+	case r.ByMonthDay == LastDay:
+		s += " on the last day"
+	case r.ByMonthDay > 0:
+		s += " on the " + ordinal(r.ByMonthDay)
+	}
+	if r.ByMonth != 0 {
+		s += " of " + r.ByMonth.String()
+	}
+	return s
+}
+
+// Next returns the first occurrence on a day after the day of after, at
+// the same time of day
+func (r *Rule) Next(after time.Time) time.Time {
+	day := when.StartOfDay(after)
+	var next time.Time
+	switch {
+	case r.Freq == Daily:
+		next = day.AddDate(0, 0, r.Interval)
+	case r.Freq == Weekly && len(r.ByDay) == 0:
+		next = day.AddDate(0, 0, 7*r.Interval)
+	case r.Freq == Weekly:
+		next = day.AddDate(0, 0, 1)
+		for !r.onDay(next.Weekday()) {
+			next = next.AddDate(0, 0, 1)
+		}
+		if r.Interval > 1 && !week(next).Equal(week(day)) {
+			next = next.AddDate(0, 0, 7*(r.Interval-1))
+		}
+	case r.Freq == Monthly && r.ByMonthDay != 0:
+		next = dayOfMonth(day, 0, r.ByMonthDay)
+		if !next.After(day) {
+			next = dayOfMonth(day, r.Interval, r.ByMonthDay)
+		}
+	case r.Freq == Monthly:
+		next = dayOfMonth(day, r.Interval, day.Day())
+	case r.ByMonth != 0:
+		jan := time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, day.Location())
+		next = dayOfMonth(jan, int(r.ByMonth-1), r.ByMonthDay)
+		if !next.After(day) {
+			next = dayOfMonth(jan, int(r.ByMonth-1)+12*r.Interval, r.ByMonthDay)
+		}
+	default:
+		next = dayOfMonth(day, 12*r.Interval, day.Day())
+	}
+	return time.Date(next.Year(), next.Month(), next.Day(),
+		after.Hour(), after.Minute(), after.Second(), 0, after.Location())
+}
+
+// First returns the first occurrence on the day of from or later, at the
+// same time of day. Rules without set days first occur on the day of from
+func (r *Rule) First(from time.Time) time.Time {
+	if len(r.ByDay) == 0 && r.ByMonthDay == 0 {
+		return from
+	}
+	return r.Next(from.AddDate(0, 0, -1))
+}
+
+func (r *Rule) onDay(wd time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// week returns the Monday the week of day begins on
+func week(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// dayOfMonth returns day d of the month months after the month of day. A
+// day past the end of the month, or LastDay, is the last day of the month
+func dayOfMonth(day time.Time, months, d int) time.Time {
+	first := time.Date(day.Year(), day.Month()+time.Month(months), 1, 0, 0, 0, 0, day.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	if d == LastDay || d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+func index(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+	"todo/internal/config"
+
+	"github.com/boltdb/bolt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var tasksBucket = []byte("tasks")
+
+// Bolt keeps the tasks in a BoltDB file. Each task is stored under its ID
+// so adding or changing a task never rewrites the others
+type Bolt struct {
+	db *bolt.DB
+}
+
+// NewBolt opens, or creates, the BoltDB file at path
+func NewBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open task database %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(tasksBucket)
+		if err != nil {
+			return err
+		}
+		return migrateIDs(bucket)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Tasks returns all tasks ordered by ID
+func (b *Bolt) Tasks() ([]*config.Task, error) {
+	var tasks []*config.Task
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).ForEach(func(k, v []byte) error {
+			task := &config.Task{}
+			if err := yaml.Unmarshal(v, task); err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+			return nil
+		})
+	})
+	return tasks, err
+}
+
+// Add a task. Tasks without an ID are given the next free one
+func (b *Bolt) Add(task *config.Task) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		if task.ID == 0 {
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			task.ID = int(seq)
+		} else if uint64(task.ID) > bucket.Sequence() {
+			if err := bucket.SetSequence(uint64(task.ID)); err != nil {
+				return err
+			}
+		}
+		return put(bucket, task)
+	})
+}
+
+// Update the task with the same ID
+func (b *Bolt) Update(task *config.Task) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		if bucket.Get(itob(task.ID)) == nil {
+			return fmt.Errorf("No task with ID %d", task.ID)
+		}
+		return put(bucket, task)
+	})
+}
+
+// Delete the task with the supplied ID
+func (b *Bolt) Delete(id int) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tasksBucket)
+		if bucket.Get(itob(id)) == nil {
+			return fmt.Errorf("No task with ID %d", id)
+		}
+		return bucket.Delete(itob(id))
+	})
+}
+
+// Close the database file
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+func put(bucket *bolt.Bucket, task *config.Task) error {
+	v, err := yaml.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(itob(task.ID), v)
+}
+
+// migrateIDs stores the key in tasks written before tasks had an ID. Keys
+// have always been sequence numbers so they are used as is
+func migrateIDs(bucket *bolt.Bucket) error {
+	var missing []*config.Task
+	err := bucket.ForEach(func(k, v []byte) error {
+		task := &config.Task{}
+		if err := yaml.Unmarshal(v, task); err != nil {
+			return err
+		}
+		if task.ID == 0 {
+			task.ID = int(binary.BigEndian.Uint64(k))
+			missing = append(missing, task)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, task := range missing {
+		if err := put(bucket, task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func itob(v int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
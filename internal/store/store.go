@@ -0,0 +1,68 @@
+// Package store keeps todo tasks in one of several storage backends
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"todo/internal/config"
+)
+
+// Store is implemented by every task storage backend
+type Store interface {
+	// Tasks returns all tasks in the order they were added
+	Tasks() ([]*config.Task, error)
+	// Add appends a new task and gives it an ID unless it already has one.
+	// IDs are never reused
+	Add(task *config.Task) error
+	// Update replaces the task with the same ID
+	Update(task *config.Task) error
+	// Delete removes the task with the supplied ID
+	Delete(id int) error
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Open the storage backend configured in cfg. file is the locked config
+// file cfg was read from
+func Open(file *config.File, cfg *config.Cfg) (Store, error) {
+	switch cfg.Store.Type {
+	case "", "yaml":
+		y := NewYAML(file, cfg)
+		if y.migrate() {
+			if err := file.Write(cfg); err != nil {
+				return nil, fmt.Errorf("Unable to assign task IDs: %v", err)
+			}
+		}
+		return y, nil
+	case "bolt":
+		path := cfg.Store.Path
+		if path == "" {
+			path = filepath.Join(filepath.Dir(file.Path()), "todo.db")
+		}
+		s, err := NewBolt(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = migrate(file, cfg, s); err != nil {
+			s.Close()
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("Unknown store type: %s", cfg.Store.Type)
+	}
+}
+
+// migrate moves any tasks still kept in the yaml file into s
+func migrate(file *config.File, cfg *config.Cfg, s Store) error {
+	if len(cfg.Tasks) == 0 {
+		return nil
+	}
+	for _, task := range cfg.Tasks {
+		if err := s.Add(task); err != nil {
+			return fmt.Errorf("Unable to migrate tasks to %s store: %v", cfg.Store.Type, err)
+		}
+	}
+	cfg.Tasks = nil
+	return file.Write(cfg)
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"fmt"
+	"todo/internal/config"
+)
+
+// YAML keeps the tasks together with the rest of the configuration in
+// todo.yaml. The whole file is rewritten on every change. If writing fails
+// the in-memory task list is left as it was before the call
+type YAML struct {
+	file *config.File
+	cfg  *config.Cfg
+}
+
+// NewYAML returns a store writing cfg to the supplied config file
+func NewYAML(file *config.File, cfg *config.Cfg) *YAML {
+	return &YAML{file: file, cfg: cfg}
+}
+
+// Tasks returns all tasks
+func (y *YAML) Tasks() ([]*config.Task, error) {
+	return y.cfg.Tasks, nil
+}
+
+// Add a task and write the file. Tasks without an ID are given the next
+// free one
+func (y *YAML) Add(task *config.Task) error {
+	y.assignID(task)
+	tasks := y.cfg.Tasks
+	y.cfg.Tasks = append(tasks, task)
+	return y.write(tasks)
+}
+
+// Update the task with the same ID and write the file
+func (y *YAML) Update(task *config.Task) error {
+	i, err := y.index(task.ID)
+	if err != nil {
+		return err
+	}
+	tasks := y.cfg.Tasks
+	y.cfg.Tasks = append([]*config.Task{}, tasks...)
+	y.cfg.Tasks[i] = task
+	return y.write(tasks)
+}
+
+// Delete the task with the supplied ID and write the file
+func (y *YAML) Delete(id int) error {
+	i, err := y.index(id)
+	if err != nil {
+		return err
+	}
+	tasks := y.cfg.Tasks
+	y.cfg.Tasks = append(append([]*config.Task{}, tasks[:i]...), tasks[i+1:]...)
+	return y.write(tasks)
+}
+
+// Close is a no-op for the yaml store
+func (y *YAML) Close() error {
+	return nil
+}
+
+// write the config file, restoring the previous task list on failure
+func (y *YAML) write(previous []*config.Task) error {
+	if err := y.file.Write(y.cfg); err != nil {
+		y.cfg.Tasks = previous
+		return err
+	}
+	return nil
+}
+
+// migrate gives an ID to tasks written before tasks had one. It reports
+// whether anything changed
+func (y *YAML) migrate() bool {
+	changed := false
+	for _, task := range y.cfg.Tasks {
+		if task.ID > y.cfg.NextID {
+			y.cfg.NextID = task.ID
+		}
+	}
+	for _, task := range y.cfg.Tasks {
+		if task.ID == 0 {
+			y.assignID(task)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (y *YAML) assignID(task *config.Task) {
+	if task.ID == 0 {
+		y.cfg.NextID++
+		task.ID = y.cfg.NextID
+	} else if task.ID > y.cfg.NextID {
+		y.cfg.NextID = task.ID
+	}
+}
+
+func (y *YAML) index(id int) (int, error) {
+	for i, task := range y.cfg.Tasks {
+		if task.ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("No task with ID %d", id)
+}
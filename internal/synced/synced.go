@@ -0,0 +1,84 @@
+// Package synced remembers the state of linked tasks as it was the last
+// time the task and its Jira issue agreed. todo sync uses it to tell
+// changes made locally from changes made in Jira
+package synced
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+	"todo/internal/config"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// State is the part of a task that is synced both ways
+type State struct {
+	Key  string    `yaml:"key"`
+	Text string    `yaml:"text"`
+	Done bool      `yaml:"done"`
+	Time time.Time `yaml:"time"`
+}
+
+// Of returns the state of task
+func Of(task *config.Task) State {
+	return State{Key: task.JiraKey, Text: task.Text, Done: task.Done}
+}
+
+// Same reports whether s and o have the same fields, ignoring Time
+func (s State) Same(o State) bool {
+	return s.Key == o.Key && s.Text == o.Text && s.Done == o.Done
+}
+
+// Snapshots are the last synced states by task ID, saved as yaml
+type Snapshots struct {
+	path   string
+	states map[int]State
+}
+
+// Open the snapshots at path. A missing file means nothing has been synced
+// yet
+func Open(path string) (*Snapshots, error) {
+	s := &Snapshots{path: path, states: map[int]State{}}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(b, &s.states); err != nil {
+		return nil, err
+	}
+	if s.states == nil {
+		s.states = map[int]State{}
+	}
+	return s, nil
+}
+
+// Get the last synced state of the task with the supplied ID
+func (s *Snapshots) Get(id int) (State, bool) {
+	state, ok := s.states[id]
+	return state, ok
+}
+
+// Set the last synced state of task to its current state and save
+func (s *Snapshots) Set(task *config.Task) error {
+	state := Of(task)
+	state.Time = time.Now()
+	s.states[task.ID] = state
+	return s.save()
+}
+
+// Delete the state of the task with the supplied ID and save
+func (s *Snapshots) Delete(id int) error {
+	if _, ok := s.states[id]; !ok {
+		return nil
+	}
+	delete(s.states, id)
+	return s.save()
+}
+
+func (s *Snapshots) save() error {
+	return config.Write(s.path, s.states)
+}
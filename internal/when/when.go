@@ -0,0 +1,228 @@
+// Package when parses the human friendly dates accepted by the todo
+// commands, e.g. "tomorrow", "fri 17:00", "next monday", "+3d" or
+// "2018-05-01"
+package when
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	relative  = regexp.MustCompile(`^([+-]?)(\d+)\s*(h|d|w|m|y)$`)
+	clock24   = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+	clock12   = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)$`)
+	isoLayout = []string{
+		time.RFC3339,
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	}
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday, "sunday": time.Sunday,
+		"mon": time.Monday, "monday": time.Monday,
+		"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+		"wed": time.Wednesday, "wednesday": time.Wednesday,
+		"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+		"fri": time.Friday, "friday": time.Friday,
+		"sat": time.Saturday, "saturday": time.Saturday,
+	}
+)
+
+// Parse s relative to now. It reports whether s contained a time of day;
+// if it did not the returned time is midnight at the start of the day
+//
+// Supported forms are "now", "today", "tomorrow", "yesterday", weekday names
+// ("fri" is the coming Friday, or today if it is Friday, "next fri" is the
+// week after that), offsets like "+3d", "-1w", "+4h", "+1m" and ISO dates.
+// Any day may be followed by a time of day like "17:00" or "5pm"
+func Parse(s string, now time.Time) (time.Time, bool, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return time.Time{}, false, fmt.Errorf("Empty date")
+	}
+	for _, layout := range isoLayout {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, layout != "2006-01-02", nil
+		}
+	}
+	s = strings.ToLower(s)
+	if s == "now" {
+		return now, true, nil
+	}
+	if m := relative.FindStringSubmatch(s); m != nil {
+		return offset(m, now)
+	}
+
+	words := strings.Split(s, " ")
+	var clock *time.Duration
+	if len(words) > 1 {
+		if d, ok := timeOfDay(words[len(words)-1]); ok {
+			clock = &d
+			words = words[:len(words)-1]
+		}
+	} else if d, ok := timeOfDay(words[0]); ok {
+		// A lone time of day means today
+		clock = &d
+		words = []string{"today"}
+	}
+	day, err := parseDay(words, now)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("Unable to parse date '%s': %v", s, err)
+	}
+	if clock != nil {
+		return day.Add(*clock), true, nil
+	}
+	return day, false, nil
+}
+
+// Due parses s like Parse, but a date without a time of day means the end
+// of that day, since that is when something due that day becomes overdue
+func Due(s string, now time.Time) (time.Time, error) {
+	t, clock, err := Parse(s, now)
+	if err != nil || clock {
+		return t, err
+	}
+	return EndOfDay(t), nil
+}
+
+// Start parses s like Parse. A date without a time of day means the
+// beginning of that day
+func Start(s string, now time.Time) (time.Time, error) {
+	t, _, err := Parse(s, now)
+	return t, err
+}
+
+// Since parses s like Start, for the beginning of a period up to now.
+// Weekday names mean the last one instead of the coming one, so "mon" is
+// the beginning of this week
+func Since(s string, now time.Time) (time.Time, error) {
+	t, err := Start(s, now)
+	if err == nil && t.After(now) {
+		if _, ok := weekdays[strings.Fields(strings.ToLower(s))[0]]; ok {
+			t = t.AddDate(0, 0, -7)
+		}
+	}
+	return t, err
+}
+
+// Until parses s like Start, for the exclusive end of a period. A date
+// without a time of day ends at midnight after that day, so the whole day
+// is included
+func Until(s string, now time.Time) (time.Time, error) {
+	t, clock, err := Parse(s, now)
+	if err != nil || clock {
+		return t, err
+	}
+	return t.AddDate(0, 0, 1), nil
+}
+
+// Weekday returns the day named by s, e.g. "fri" or "friday"
+func Weekday(s string) (time.Weekday, bool) {
+	wd, ok := weekdays[strings.ToLower(s)]
+	return wd, ok
+}
+
+// StartOfDay returns midnight at the beginning of the day of t
+func StartOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// EndOfDay returns the last second of the day of t
+func EndOfDay(t time.Time) time.Time {
+	return StartOfDay(t).AddDate(0, 0, 1).Add(-time.Second)
+}
+
+// IsEndOfDay reports whether t is the last second of its day, i.e. a date
+// without a time of day given to Due
+func IsEndOfDay(t time.Time) bool {
+	return t.Equal(EndOfDay(t))
+}
+
+func offset(m []string, now time.Time) (time.Time, bool, error) {
+	n, err := strconv.Atoi(m[2])
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if m[1] == "-" {
+		n = -n
+	}
+	day := StartOfDay(now)
+	switch m[3] {
+	case "h":
+		return now.Add(time.Duration(n) * time.Hour), true, nil
+	case "d":
+		return day.AddDate(0, 0, n), false, nil
+	case "w":
+		return day.AddDate(0, 0, 7*n), false, nil
+	case "m":
+		return day.AddDate(0, n, 0), false, nil
+	}
+	return day.AddDate(n, 0, 0), false, nil
+}
+
+func parseDay(words []string, now time.Time) (time.Time, error) {
+	today := StartOfDay(now)
+	next := false
+	if len(words) == 2 && words[0] == "next" {
+		next = true
+		words = words[1:]
+	}
+	if len(words) != 1 {
+		return time.Time{}, fmt.Errorf("unknown format")
+	}
+	word := words[0]
+	if !next {
+		switch word {
+		case "today":
+			return today, nil
+		case "tomorrow", "tmrw":
+			return today.AddDate(0, 0, 1), nil
+		case "yesterday":
+			return today.AddDate(0, 0, -1), nil
+		}
+	}
+	if word == "week" && next {
+		return today.AddDate(0, 0, 7), nil
+	}
+	wd, ok := weekdays[word]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown day '%s'", word)
+	}
+	days := (int(wd) - int(today.Weekday()) + 7) % 7
+	if next {
+		days += 7
+	}
+	return today.AddDate(0, 0, days), nil
+}
+
+// timeOfDay parses "17:00", "5pm" or "5:30pm" into an offset from midnight
+func timeOfDay(s string) (time.Duration, bool) {
+	var h, min int
+	if m := clock24.FindStringSubmatch(s); m != nil {
+		h, _ = strconv.Atoi(m[1])
+		min, _ = strconv.Atoi(m[2])
+	} else if m := clock12.FindStringSubmatch(s); m != nil {
+		h, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			min, _ = strconv.Atoi(m[2])
+		}
+		if h < 1 || h > 12 {
+			return 0, false
+		}
+		h = h % 12
+		if m[3] == "pm" {
+			h += 12
+		}
+	} else {
+		return 0, false
+	}
+	if h > 23 || min > 59 {
+		return 0, false
+	}
+	return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute, true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"todo/internal/config"
+
+	"jira"
+)
+
+func TestAuthenticators(t *testing.T) {
+	var auth, query string
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		auth = r.Header.Get("Authorization")
+		query = r.URL.RawQuery
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer server.Close()
+	c := newClient(t, server.URL)
+
+	c.Auth = &jira.BasicAuth{User: "me@example.com", Token: "api-token"}
+	if err := c.DeleteIssue("10001"); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Basic "+base64.StdEncoding.EncodeToString([]byte("me@example.com:api-token")) || query != "" {
+		t.Errorf("Expected basic auth only, got %q %q", auth, query)
+	}
+	c.Auth = &jira.BearerAuth{Token: "pat"}
+	if err := c.DeleteIssue("10001"); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer pat" || query != "" {
+		t.Errorf("Expected a bearer token only, got %q %q", auth, query)
+	}
+	// Without Auth requests are signed with the OAuth token
+	c.Auth = nil
+	c.Token = "access-token"
+	if err := c.DeleteIssue("10001"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(auth, "OAuth ") || !strings.Contains(auth, `oauth_token="access-token"`) || query != "" {
+		t.Errorf("Expected an OAuth signed request, got %q %q", auth, query)
+	}
+}
+
+func TestGeneratedKeyEncryptsTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo", "todo_key.pem")
+	key, err := config.GenerateRSAKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("The key should only be readable by the user: %v %v", fi.Mode(), err)
+	}
+	read, err := config.ReadRSAKey(path)
+	if err != nil || !read.Equal(key) {
+		t.Fatalf("Expected to read back the generated key: %v", err)
+	}
+	enc, err := config.Encrypt(&key.PublicKey, "api-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec, err := config.Decrypt(read, enc); err != nil || dec != "api-token" {
+		t.Errorf("Expected the token back, got %q %v", dec, err)
+	}
+	if _, err := config.ReadRSAKey(filepath.Join(t.TempDir(), "missing.pem")); !os.IsNotExist(unwrap(err)) {
+		t.Errorf("A missing key should be reported as such: %v", err)
+	}
+}
+
+func unwrap(err error) error {
+	for {
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return err
+		}
+		err = u.Unwrap()
+	}
+}
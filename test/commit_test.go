@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"todo/cmd"
+	"todo/internal/config"
+	"todo/internal/store"
+)
+
+func TestAddRollsBackJira(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{broken: true}
+	todo := newTodo(t, server, s)
+
+	err := todo.Add("write report", false)
+	if err == nil {
+		t.Fatalf("Add should fail when the task can't be saved")
+	}
+	if _, ok := err.(*cmd.OutOfSyncError); ok {
+		t.Errorf("Jira issue was deleted, Jira and the todo list should be in sync: %v", err)
+	}
+	if !server.called("DELETE /rest/api/2/issue/10001") {
+		t.Errorf("Created Jira issue was not deleted: %v", server.requests)
+	}
+	if len(s.tasks) != 0 {
+		t.Errorf("No task should be saved")
+	}
+}
+
+func TestAddOutOfSync(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.fail["DELETE /rest/api/2/issue/10001"] = true
+	s := &flakyStore{broken: true}
+	todo := newTodo(t, server, s)
+
+	err := todo.Add("write report", false)
+	e, ok := err.(*cmd.OutOfSyncError)
+	if !ok {
+		t.Fatalf("Expected *cmd.OutOfSyncError, got %v", err)
+	}
+	if e.Err != errBroken || e.Rollback == nil || !strings.Contains(e.Error(), "PRJ-1") {
+		t.Errorf("Error does not tell what is out of sync: %v", e)
+	}
+	s.broken = false
+	if err = e.Retry(); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if len(s.tasks) != 1 || s.tasks[0].JiraKey != "PRJ-1" {
+		t.Errorf("Retry did not save the linked task: %+v", s.tasks)
+	}
+}
+
+// failingAdd is a store whose first Add fails
+type failingAdd struct {
+	store.Store
+	failed bool
+}
+
+func (s *failingAdd) Add(task *config.Task) error {
+	if !s.failed {
+		s.failed = true
+		return errBroken
+	}
+	return s.Store.Add(task)
+}
+
+func TestRepairRetriesBeforeClosing(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.fail["DELETE /rest/api/2/issue/10001"] = true
+	path := filepath.Join(t.TempDir(), "todo.db")
+	bolt, err := store.NewBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := newTodo(t, server, &flakyStore{})
+	todo.Store = &failingAdd{Store: bolt}
+	todo.In = strings.NewReader("y\n")
+	todo.Out = ioutil.Discard
+
+	err = todo.Add("write report", false)
+	if _, ok := err.(*cmd.OutOfSyncError); !ok {
+		t.Fatalf("Expected *cmd.OutOfSyncError, got %v", err)
+	}
+	if err := todo.Finish(err); err != nil {
+		t.Fatalf("Expected the retry to save the task: %v", err)
+	}
+	if bolt, err = store.NewBolt(path); err != nil {
+		t.Fatalf("Expected the store to be closed after the retry: %v", err)
+	}
+	defer bolt.Close()
+	tasks, err := bolt.Tasks()
+	if err != nil || len(tasks) != 1 || tasks[0].JiraKey != "PRJ-1" {
+		t.Errorf("Expected the linked task to be saved, got %+v %v", tasks, err)
+	}
+}
+
+func TestCompleteRollsBackJira(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := newTodo(t, server, s)
+	s.broken = true
+
+	if err := todo.Complete([]string{"1"}); err == nil {
+		t.Fatalf("Complete should fail when the task can't be saved")
+	}
+	if !server.called("POST /rest/api/2/issue/10001/transitions") {
+		t.Errorf("Jira issue was never transitioned: %v", server.requests)
+	}
+	if n := len(server.requests); n != 2 {
+		t.Errorf("Expected the transition to be reverted, got requests %v", server.requests)
+	}
+}
+
+func TestJiraFailureKeepsLocalState(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.fail["POST /rest/api/2/issue"] = true
+	s := &flakyStore{}
+	todo := newTodo(t, server, s)
+
+	if err := todo.Add("write report", false); err == nil {
+		t.Fatalf("Add should fail when Jira fails")
+	}
+	if len(s.tasks) != 0 {
+		t.Errorf("Task should not be saved when Jira fails")
+	}
+	if err := todo.Add("write report", true); err != nil || len(s.tasks) != 1 {
+		t.Errorf("Offline add should not touch Jira: %v", err)
+	}
+}
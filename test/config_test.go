@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"todo/internal/config"
+)
+
+func TestConfigFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.yaml")
+	f, err := config.Open(path)
+	if err != nil {
+		t.Fatalf("Could not open config file: %v", err)
+	}
+	timeout := config.LockTimeout
+	config.LockTimeout = 100 * time.Millisecond
+	defer func() { config.LockTimeout = timeout }()
+	if _, err := config.Open(path); err == nil {
+		t.Errorf("Should not be able to lock an already locked config file")
+	}
+	f.Close()
+	f, err = config.Open(path)
+	if err != nil {
+		t.Fatalf("Could not lock released config file: %v", err)
+	}
+	f.Close()
+}
+
+func TestConfigFileModified(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.yaml")
+	if err := config.Write(path, &config.Cfg{}); err != nil {
+		t.Fatalf("Could not write config file: %v", err)
+	}
+	f, err := config.Open(path)
+	if err != nil {
+		t.Fatalf("Could not open config file: %v", err)
+	}
+	defer f.Close()
+	cfg, err := f.Read()
+	if err != nil {
+		t.Fatalf("Could not read config file: %v", err)
+	}
+	cfg.Tasks = append(cfg.Tasks, &config.Task{Text: "first"})
+	if err := f.Write(cfg); err != nil {
+		t.Fatalf("Could not write config file: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("tasks: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write(cfg); err != config.ErrModified {
+		t.Errorf("Expected ErrModified, got %v", err)
+	}
+	entries, _ := ioutil.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		if e.Name() != "todo.yaml" && e.Name() != "todo.yaml.lock" {
+			t.Errorf("Temporary file left behind: %s", e.Name())
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Config file missing: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"jira"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterruptLeavesTasksAlone(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	hung := make(chan struct{})
+	hang := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		<-hung
+	})
+	defer hang.Close()
+	defer close(hung)
+	s := &flakyStore{}
+	todo := newTodo(t, server, s, withOutbox)
+	todo.JC.BaseURL = hang.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	todo.Context = ctx
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	err := todo.Add("write report", false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the add to be cancelled, got %v", err)
+	}
+	if len(s.tasks) != 0 || len(todo.Outbox.Ops()) != 0 {
+		t.Errorf("An interrupted add should neither save nor queue anything: %+v %+v", s.tasks, todo.Outbox.Ops())
+	}
+}
+
+func TestCancelStopsRetryWait(t *testing.T) {
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	defer server.Close()
+	c := newClient(t, server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.SearchIssuesContext(ctx, []byte(`{"jql":"project = PRJ"}`))
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Errorf("Expected the wait for a retry to end with the context, got %v after %v", err, time.Since(start))
+	}
+	if jira.IsNetworkError(context.Canceled) {
+		t.Errorf("A cancelled request is not a network error")
+	}
+}
+
+func TestInterruptQuitsPrompt(t *testing.T) {
+	c := exec.Command(os.Args[0], "-test.run=^TestRunTodo$", "--", "init", "--auth", "pat")
+	c.Env = append(os.Environ(), "TODO_RUN_MAIN=1", "HOME="+t.TempDir())
+	in, err := c.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := c.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Process.Kill()
+	prompt := make([]byte, 1024)
+	var seen string
+	for !strings.Contains(seen, "Enter Jira URL") {
+		n, err := out.Read(prompt)
+		if err != nil {
+			t.Fatalf("Expected init to ask for the Jira URL, got %v: %s", err, seen)
+		}
+		seen += string(prompt[:n])
+	}
+
+	c.Process.Signal(os.Interrupt)
+	exited := make(chan error, 1)
+	go func() { exited <- c.Wait() }()
+	select {
+	case err := <-exited:
+		if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 130 {
+			t.Errorf("Expected init to quit with 130, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected a single Ctrl-C to quit the prompt")
+	}
+}
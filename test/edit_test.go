@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"todo/internal/config"
+)
+
+func TestEditDueDate(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := newTodo(t, server, s)
+
+	due := time.Date(2018, 5, 4, 23, 59, 59, 0, time.Local)
+	err := todo.Edit([]string{"1"}, func(task *config.Task) error {
+		task.Due = due
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Could not edit task: %v", err)
+	}
+	if !s.tasks[0].Due.Equal(due) {
+		t.Errorf("Due date was not saved: %v", s.tasks[0].Due)
+	}
+	if len(server.updates) != 1 || !strings.Contains(server.updates[0], `"duedate":"2018-05-04"`) {
+		t.Errorf("Jira duedate was not updated: %v", server.updates)
+	}
+
+	err = todo.Edit([]string{"1"}, func(task *config.Task) error {
+		task.Due = time.Time{}
+		return nil
+	})
+	if err != nil || len(server.updates) != 2 || !strings.Contains(server.updates[1], `"duedate":null`) {
+		t.Errorf("Clearing the due date should clear it in Jira: %v %v", server.updates, err)
+	}
+	if err = todo.Edit([]string{"1"}, func(task *config.Task) error { return nil }); err == nil {
+		t.Errorf("An edit without changes should fail")
+	}
+}
+
+func TestEditText(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := newTodo(t, server, s)
+
+	err := todo.Edit([]string{"1"}, func(task *config.Task) error {
+		task.Text = "write final report"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Could not edit task: %v", err)
+	}
+	if s.tasks[0].Text != "write final report" || s.tasks[0].JiraKey != "PRJ-1" {
+		t.Errorf("Text was not changed in place: %+v", s.tasks[0])
+	}
+	if len(server.updates) != 1 || !strings.Contains(server.updates[0], `"summary":"TODO: write final report"`) {
+		t.Errorf("Jira summary was not updated: %v", server.updates)
+	}
+}
+
+func TestEditInEditor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake editor is a shell script")
+	}
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", Tags: []string{"docs"}}}}
+	todo := newTodo(t, server, s)
+
+	editor := filepath.Join(t.TempDir(), "editor.sh")
+	script := `#!/bin/sh
+sed -e 's/^text: .*/text: write final report/' -e 's/^priority: .*/priority: high/' \
+    -e 's/^tags: .*/tags: [docs, urgent]/' -e 's/^due: .*/due: 2018-05-04/' "$1" > "$1.new"
+mv "$1.new" "$1"
+`
+	if err := ioutil.WriteFile(editor, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+
+	if err := todo.EditInEditor([]string{"1"}); err != nil {
+		t.Fatalf("Could not edit task: %v", err)
+	}
+	task := s.tasks[0]
+	due := time.Date(2018, 5, 4, 23, 59, 59, 0, time.Local)
+	if task.Text != "write final report" || task.Priority != "High" || len(task.Tags) != 2 || !task.Due.Equal(due) {
+		t.Errorf("Edited fields were not saved: %+v", task)
+	}
+}
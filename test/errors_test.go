@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"jira"
+	"net/http"
+	"strings"
+	"testing"
+	"todo/internal/config"
+)
+
+func TestAPIErrors(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.reply["DELETE /rest/api/2/issue/10001"] = fakeReply{
+		http.StatusNotFound, `{"errorMessages":["Issue Does Not Exist"],"errors":{}}`}
+	server.reply["DELETE /rest/api/2/issue/10002"] = fakeReply{
+		http.StatusUnauthorized, "oauth_problem=token_rejected&oauth_problem_advice=expired"}
+	server.reply["DELETE /rest/api/2/issue/10003"] = fakeReply{
+		http.StatusBadGateway, "<html>Bad gateway</html>"}
+	c := newTodo(t, server, &flakyStore{}).JC
+
+	err := c.DeleteIssue("10001")
+	var apiErr *jira.APIError
+	if !errors.As(err, &apiErr) || !jira.IsNotFound(err) || jira.IsUnauthorized(err) ||
+		apiErr.Messages[0] != "Issue Does Not Exist" {
+		t.Errorf("Expected a not found error with the Jira message, got %#v", err)
+	}
+	if err.Error() != "Could not delete Jira issue: 404 Issue Does Not Exist" {
+		t.Errorf("Unexpected message: %v", err)
+	}
+	err = c.DeleteIssue("10002")
+	if !jira.IsTokenRejected(err) || !jira.IsUnauthorized(err) || jira.IsNotFound(err) {
+		t.Errorf("Expected a rejected token, got %#v", err)
+	}
+	err = c.DeleteIssue("10003")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.Body != "<html>Bad gateway</html>" {
+		t.Errorf("Expected the raw body of a non Jira response, got %#v", err)
+	}
+}
+
+func TestAPIErrorMessages(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.reply["POST /rest/api/2/issue/10001/transitions"] = fakeReply{
+		http.StatusNotFound, `{"errorMessages":["Issue Does Not Exist"]}`}
+	server.reply["POST /rest/api/2/issue/10002/transitions"] = fakeReply{
+		http.StatusBadRequest, `{"errorMessages":[],"errors":{"transition":"Transition id '31' is not valid for this issue."}}`}
+	server.reply["DELETE /rest/api/2/issue/10003"] = fakeReply{
+		http.StatusNotFound, `{"errorMessages":["Issue Does Not Exist"]}`}
+	s := &flakyStore{tasks: []*config.Task{
+		{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"},
+		{ID: 2, Text: "review PR", JiraID: "10002", JiraKey: "PRJ-2"},
+		{ID: 3, Text: "old task", JiraID: "10003", JiraKey: "PRJ-3"},
+	}}
+	todo := newTodo(t, server, s)
+
+	err := todo.Complete([]string{"1"})
+	if !jira.IsNotFound(err) || !strings.Contains(err.Error(), "PRJ-1 no longer exists") {
+		t.Errorf("Expected to be told the issue is gone, got %v", err)
+	}
+	err = todo.Complete([]string{"2"})
+	if err == nil || !strings.Contains(err.Error(), "doesn't allow changing the status of PRJ-2") {
+		t.Errorf("Expected to be told the transition isn't allowed, got %v", err)
+	}
+	if s.tasks[0].Done || s.tasks[1].Done {
+		t.Errorf("Rejected changes should not be saved: %+v", s.tasks)
+	}
+	// Deleting a task whose issue is already gone just deletes the task
+	if err := todo.Del([]string{"3"}); err != nil || len(s.tasks) != 2 {
+		t.Errorf("Expected the task to be deleted: %v %+v", err, s.tasks)
+	}
+}
+
+func TestPullAndSyncKeepJiraErrors(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.reply["POST /rest/api/2/search"] = fakeReply{
+		http.StatusUnauthorized, "oauth_problem=token_rejected&oauth_problem_advice=expired"}
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := newTodo(t, server, s, withSynced)
+	todo.Config.Jira.Project.Key = "PRJ"
+
+	if err := todo.Pull(""); !jira.IsTokenRejected(err) {
+		t.Errorf("Expected pull to report the rejected token, got %v", err)
+	}
+	if err := todo.Sync("skip"); !jira.IsTokenRejected(err) {
+		t.Errorf("Expected sync to report the rejected token, got %v", err)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"jira"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"todo/cmd"
+	"todo/internal/config"
+	"todo/internal/outbox"
+	"todo/internal/synced"
+
+	"github.com/dghubble/oauth1"
+)
+
+// fakeJira is a minimal stand-in for the Jira REST API. It records every
+// request and fails the ones listed in fail, or answers them as set in
+// reply. Issues are kept in remote by ID so they can be searched
+type fakeJira struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+	fail     map[string]bool
+	reply    map[string]fakeReply
+	issues   int
+	updates  []string
+	created  []string
+	remote   map[string]*jira.Issue
+	// comments are the comments on the issues, by issue ID
+	comments    map[string][]jira.Comment
+	commentSeq  int
+	transitions []string
+	// worklogs are the worklogs on the issues, by issue ID
+	worklogs map[string][]jira.Worklog
+}
+
+func newFakeJira() *fakeJira {
+	f := &fakeJira{fail: map[string]bool{}, reply: map[string]fakeReply{}, remote: map[string]*jira.Issue{},
+		comments: map[string][]jira.Comment{}, worklogs: map[string][]jira.Worklog{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+// fakeReply is a canned response
+type fakeReply struct {
+	status int
+	body   string
+}
+
+// issue adds an issue to the fake, done if it is in a done status
+func (f *fakeJira) issue(id, key, summary string, done bool) *jira.Issue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	issue := &jira.Issue{ID: id, Key: key}
+	issue.Fields.Summary = summary
+	setStatus(issue, done)
+	f.remote[id] = issue
+	return issue
+}
+
+func setStatus(issue *jira.Issue, done bool) {
+	issue.Fields.Status = &jira.Status{Name: "To Do"}
+	issue.Fields.Status.StatusCategory.Key = "new"
+	if done {
+		issue.Fields.Status.Name = "Done"
+		issue.Fields.Status.StatusCategory.Key = jira.StatusDone
+	}
+}
+
+var idList = regexp.MustCompile(`^id in \(([^)]*)\)$`)
+
+// search answers a search request. "id in (...)" finds those issues, any
+// other JQL finds all issues
+func (f *fakeJira) search(w http.ResponseWriter, body []byte) {
+	var req struct {
+		JQL        string `json:"jql"`
+		StartAt    int    `json:"startAt"`
+		MaxResults int    `json:"maxResults"`
+	}
+	json.Unmarshal(body, &req)
+	var ids []string
+	if m := idList.FindStringSubmatch(req.JQL); m != nil {
+		ids = strings.Split(m[1], ",")
+	} else {
+		for id := range f.remote {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+	var found []*jira.Issue
+	for _, id := range ids {
+		if issue, ok := f.remote[strings.TrimSpace(id)]; ok {
+			found = append(found, issue)
+		}
+	}
+	total := len(found)
+	if req.StartAt < len(found) {
+		found = found[req.StartAt:]
+	} else {
+		found = nil
+	}
+	if req.MaxResults > 0 && len(found) > req.MaxResults {
+		found = found[:req.MaxResults]
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"startAt": req.StartAt, "maxResults": req.MaxResults, "total": total, "issues": found,
+	})
+}
+
+func (f *fakeJira) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	req := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+	f.requests = append(f.requests, req)
+	if f.fail[req] {
+		http.Error(w, `{"errorMessages":["fake failure"]}`, http.StatusInternalServerError)
+		return
+	}
+	if reply, ok := f.reply[req]; ok {
+		w.WriteHeader(reply.status)
+		fmt.Fprint(w, reply.body)
+		return
+	}
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/rest/api/2/issue":
+		b, _ := ioutil.ReadAll(r.Body)
+		f.created = append(f.created, string(b))
+		f.issues++
+		issue := &jira.Issue{}
+		json.Unmarshal(b, issue)
+		issue.ID = fmt.Sprintf("%d", 10000+f.issues)
+		issue.Key = fmt.Sprintf("PRJ-%d", f.issues)
+		setStatus(issue, false)
+		f.remote[issue.ID] = issue
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":"%s","key":"%s","self":""}`, issue.ID, issue.Key)
+	case r.Method == "POST" && r.URL.Path == "/rest/api/2/search":
+		b, _ := ioutil.ReadAll(r.Body)
+		f.search(w, b)
+	case comment.MatchString(r.URL.Path):
+		f.comment(w, r)
+	case worklog.MatchString(r.URL.Path):
+		f.worklog(w, r)
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/rest/api/2/issue/"):
+		issue, ok := f.remote[path.Base(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		got := *issue
+		got.Fields.Comment = &jira.Comments{Comments: f.comments[issue.ID], Total: len(f.comments[issue.ID])}
+		json.NewEncoder(w).Encode(got)
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/rest/api/2/issue/"):
+		delete(f.remote, path.Base(r.URL.Path))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/rest/api/2/issue/"):
+		b, _ := ioutil.ReadAll(r.Body)
+		f.updates = append(f.updates, string(b))
+		var update struct {
+			Fields struct {
+				Summary *string `json:"summary"`
+			} `json:"fields"`
+		}
+		json.Unmarshal(b, &update)
+		if issue, ok := f.remote[path.Base(r.URL.Path)]; ok && update.Fields.Summary != nil {
+			issue.Fields.Summary = *update.Fields.Summary
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/transitions"):
+		var transition struct {
+			Transition struct {
+				ID string `json:"id"`
+			} `json:"transition"`
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		f.transitions = append(f.transitions, string(b))
+		json.Unmarshal(b, &transition)
+		if issue, ok := f.remote[path.Base(path.Dir(r.URL.Path))]; ok {
+			setStatus(issue, transition.Transition.ID == "31")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeJira) called(req string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.requests {
+		if r == req {
+			return true
+		}
+	}
+	return false
+}
+
+// flakyStore is an in-memory store whose writes fail while broken is set
+type flakyStore struct {
+	tasks  []*config.Task
+	broken bool
+}
+
+var errBroken = errors.New("disk full")
+
+func (s *flakyStore) Tasks() ([]*config.Task, error) { return s.tasks, nil }
+func (s *flakyStore) Close() error                   { return nil }
+
+func (s *flakyStore) Add(task *config.Task) error {
+	if s.broken {
+		return errBroken
+	}
+	if task.ID == 0 {
+		task.ID = len(s.tasks) + 1
+	}
+	s.tasks = append(s.tasks, task)
+	return nil
+}
+
+func (s *flakyStore) Update(task *config.Task) error {
+	if s.broken {
+		return errBroken
+	}
+	for i := range s.tasks {
+		if s.tasks[i].ID == task.ID {
+			s.tasks[i] = task
+		}
+	}
+	return nil
+}
+
+func (s *flakyStore) Delete(id int) error {
+	if s.broken {
+		return errBroken
+	}
+	for i, task := range s.tasks {
+		if task.ID == id {
+			s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+		}
+	}
+	return nil
+}
+
+// todoOption sets up a part of a todo for a test
+type todoOption func(t *testing.T, todo *cmd.Todo)
+
+// newTodo returns a todo using server as Jira and s as its store, set up
+// further with opts
+func newTodo(t *testing.T, server *fakeJira, s *flakyStore, opts ...todoOption) *cmd.Todo {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := &cmd.Todo{}
+	todo.JC = jira.NewClient(&oauth1.Config{
+		ConsumerKey: "Todo",
+		Signer:      &oauth1.RSASigner{PrivateKey: key},
+	})
+	todo.JC.BaseURL = server.URL
+	todo.Config = &config.Cfg{}
+	todo.Config.Jira.Project = config.Project{DoneID: "31", BacklogID: "11"}
+	todo.Store = s
+	return setup(t, todo, opts...)
+}
+
+// setup applies opts to todo
+func setup(t *testing.T, todo *cmd.Todo, opts ...todoOption) *cmd.Todo {
+	for _, opt := range opts {
+		opt(t, todo)
+	}
+	return todo
+}
+
+// withSynced remembers the synced state of the tasks
+func withSynced(t *testing.T, todo *cmd.Todo) {
+	var err error
+	if todo.Synced, err = synced.Open(filepath.Join(t.TempDir(), "todo.synced")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// withOutbox queues the changes Jira can't be reached for
+func withOutbox(t *testing.T, todo *cmd.Todo) {
+	var err error
+	if todo.Outbox, err = outbox.Open(filepath.Join(t.TempDir(), "todo.outbox")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// withConfigFile gives todo a locked, empty config file
+func withConfigFile(t *testing.T, todo *cmd.Todo) {
+	var err error
+	if todo.ConfigFile, err = config.Open(filepath.Join(t.TempDir(), "todo.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { todo.ConfigFile.Close() })
+}
+
+func newClient(t *testing.T, url string) *jira.Client {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := jira.NewClient(&oauth1.Config{
+		ConsumerKey: "Todo",
+		Signer:      &oauth1.RSASigner{PrivateKey: key},
+	})
+	c.BaseURL = url
+	c.RetryWait = time.Millisecond
+	return c
+}
+
+// countingServer answers with handle and counts the requests
+type countingServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls int
+}
+
+func newCountingServer(handle func(w http.ResponseWriter, r *http.Request, call int)) *countingServer {
+	s := &countingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls++
+		call := s.calls
+		s.mu.Unlock()
+		handle(w, r, call)
+	}))
+	return s
+}
+
+// unreachable returns the URL of a server that is no longer running
+func unreachable() string {
+	down := httptest.NewServer(nil)
+	down.Close()
+	return down.URL
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"todo/cmd"
+	"todo/internal/config"
+)
+
+func TestInitWithoutPrompts(t *testing.T) {
+	server := newOAuthJira(t)
+	defer server.Close()
+	todo := setup(t, &cmd.Todo{}, withConfigFile)
+	todo.PrivateKey = server.key
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("access-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := todo.SetupJira(cmd.InitOptions{
+		URL:          server.URL + "/",
+		TokenFile:    tokenFile,
+		Project:      "PRJ",
+		DoneStatus:   "done",
+		ReopenStatus: "Backlog",
+		IssueType:    "bug",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := todo.ConfigFile.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := cfg.Jira.Project
+	if cfg.Jira.URL != server.URL || p.Key != "PRJ" || p.IssueType != "4" ||
+		p.DoneStatus != (config.Status{ID: "10", Name: "Done", Category: "done"}) ||
+		p.ReopenStatus != (config.Status{ID: "1", Name: "Backlog", Category: "new"}) {
+		t.Errorf("Unexpected config %+v", cfg.Jira)
+	}
+	if token, err := config.Decrypt(server.key, cfg.Jira.Token); err != nil || token != "access-token" {
+		t.Errorf("Expected the token of the file, got %q %v", token, err)
+	}
+
+	err = todo.SetupJira(cmd.InitOptions{URL: server.URL, TokenFile: tokenFile, Project: "PRJ", DoneStatus: "Resolved"})
+	if err == nil || !strings.Contains(err.Error(), "Backlog, In Progress, Done") {
+		t.Errorf("Expected the available statuses to be listed, got %v", err)
+	}
+	err = todo.SetupJira(cmd.InitOptions{URL: server.URL, TokenFile: tokenFile, Project: "OPS", DoneStatus: "Done"})
+	if err == nil || !strings.Contains(err.Error(), "No Jira project with key 'OPS'") {
+		t.Errorf("Expected an unknown project to be reported, got %v", err)
+	}
+}
+
+func TestInitEncryptsFullLengthToken(t *testing.T) {
+	server := newOAuthJira(t)
+	defer server.Close()
+	todo := setup(t, &cmd.Todo{}, withConfigFile)
+	// The size of key the README creates for the application link
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.key, todo.PrivateKey = key, key
+	token := strings.Repeat("ATATT3xFfGF0", 24)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err = todo.SetupJira(cmd.InitOptions{URL: server.URL, TokenFile: tokenFile, Project: "PRJ", DoneStatus: "Done", IssueType: "Task"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := todo.ConfigFile.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec, err := config.Decrypt(key, cfg.Jira.Token); err != nil || dec != token {
+		t.Errorf("Expected the %d characters of the token back, got %q %v", len(token), dec, err)
+	}
+
+	// Tokens saved before they were encrypted with AES-GCM are still read
+	old, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &key.PublicKey, []byte("old-token"), []byte("todo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec, err := config.Decrypt(key, base64.StdEncoding.EncodeToString(old)); err != nil || dec != "old-token" {
+		t.Errorf("Expected the old token back, got %q %v", dec, err)
+	}
+}
+
+func TestInitAuthorizesInTwoSteps(t *testing.T) {
+	server := newOAuthJira(t)
+	defer server.Close()
+	todo := setup(t, &cmd.Todo{}, withConfigFile)
+	todo.PrivateKey = server.key
+
+	if err := todo.SetupJira(cmd.InitOptions{URL: server.URL, PrintAuthorizeURL: true}); err != nil {
+		t.Fatal(err)
+	}
+	if server.params["oauth_callback"] != "oob" {
+		t.Errorf("Expected Jira to be asked for a verification code: %v", server.params)
+	}
+	pending := filepath.Join(filepath.Dir(todo.ConfigFile.Path()), "todo.authorize")
+	if _, err := os.Stat(pending); err != nil {
+		t.Fatalf("The request token should be kept for --verifier: %v", err)
+	}
+
+	err := todo.SetupJira(cmd.InitOptions{Verifier: "123456", Project: "PRJ", DoneStatus: "Done"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := todo.ConfigFile.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := config.Decrypt(server.key, cfg.Jira.Token); token != "access-token" || cfg.Jira.URL != server.URL {
+		t.Errorf("Expected the access token for %s, got %q %+v", server.URL, token, cfg.Jira)
+	}
+	if cfg.Jira.Project.IssueType != "3" || cfg.Jira.Project.DoneStatus.Category != "done" ||
+		cfg.Jira.Project.ReopenStatus != (config.Status{Category: "new"}) {
+		t.Errorf("Unexpected project %+v", cfg.Jira.Project)
+	}
+	if _, err := os.Stat(pending); !os.IsNotExist(err) {
+		t.Errorf("The request token should be removed once used: %v", err)
+	}
+	if err := todo.SetupJira(cmd.InitOptions{Verifier: "123456"}); err == nil {
+		t.Errorf("Expected an error without a pending authorization")
+	}
+}
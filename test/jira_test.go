@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"jira"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPaginate(t *testing.T) {
+	values := make([]int, 23)
+	var starts []int
+	got, err := jira.Paginate(0, 10, func(startAt, maxResults int) (*jira.Page[int], error) {
+		starts = append(starts, startAt)
+		end := startAt + maxResults
+		if end > len(values) {
+			end = len(values)
+		}
+		return &jira.Page[int]{Values: values[startAt:end], Total: len(values)}, nil
+	})
+	if err != nil || len(got) != 23 || fmt.Sprint(starts) != "[0 10 20]" {
+		t.Errorf("Expected 23 values in 3 pages, got %d values from %v: %v", len(got), starts, err)
+	}
+	// Without a total the last page ends it
+	got, _ = jira.Paginate(0, 10, func(startAt, maxResults int) (*jira.Page[int], error) {
+		return &jira.Page[int]{Values: values[:maxResults], Last: startAt >= 10}, nil
+	})
+	if len(got) != 20 {
+		t.Errorf("Expected the last page to end it, got %d values", len(got))
+	}
+}
+
+func TestListProjectsPaginates(t *testing.T) {
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		if r.URL.Path != "/rest/api/2/project/search" {
+			http.NotFound(w, r)
+			return
+		}
+		startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		maxResults, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+		var values []jira.Project
+		for i := startAt; i < startAt+maxResults && i < 120; i++ {
+			values = append(values, jira.Project{ID: strconv.Itoa(i), Key: fmt.Sprintf("P%d", i), Name: "Project"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"startAt": startAt, "maxResults": maxResults, "total": 120,
+			"isLast": startAt+maxResults >= 120, "values": values,
+		})
+	})
+	defer server.Close()
+
+	projects, err := newClient(t, server.URL).ListProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 120 || server.calls != 3 {
+		t.Errorf("Expected 120 projects in 3 requests, got %d in %d", len(projects), server.calls)
+	}
+	if m := jira.MatchProjects(projects, "p11"); len(m) != 11 || m[0].Key != "P11" {
+		t.Errorf("Expected the exact key match first: %v", m)
+	}
+}
+
+func TestListProjectsWithoutSearch(t *testing.T) {
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		if r.URL.Path != "/rest/api/2/project" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `[{"id":"1","key":"PRJ","name":"Project"},{"id":"2","key":"OPS","name":"Operations"}]`)
+	})
+	defer server.Close()
+
+	projects, err := newClient(t, server.URL).ListProjects()
+	if err != nil || len(projects) != 2 {
+		t.Errorf("Expected to fall back to listing all projects: %v %v", projects, err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		switch call {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, `{"startAt":0,"maxResults":50,"total":1,"issues":[{"id":"10001"}]}`)
+		}
+	})
+	defer server.Close()
+
+	issues, err := newClient(t, server.URL).SearchIssues([]byte(`{"jql":"project = PRJ"}`))
+	if err != nil || len(issues) != 1 || server.calls != 3 {
+		t.Errorf("Expected the search to succeed on the third attempt: %v %v, %d calls", issues, err, server.calls)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+
+	c := newClient(t, server.URL)
+	c.MaxRetries = 2
+	if _, err := c.SearchIssues([]byte(`{"jql":"project = PRJ"}`)); err == nil {
+		t.Errorf("Expected the search to fail")
+	}
+	if server.calls != 3 {
+		t.Errorf("Expected 1 attempt and 2 retries, got %d calls", server.calls)
+	}
+}
+
+func TestRetryDoesNotRepeatCreate(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		if call == 1 {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":"10001","key":"PRJ-1"}`)
+	})
+	defer server.Close()
+
+	c := newClient(t, server.URL)
+	if _, err := c.CreateIssue(&jira.Issue{}); err == nil || server.calls != 1 {
+		t.Errorf("Expected a create answered with 503 to fail without a retry: %v, %d calls", err, server.calls)
+	}
+	server.calls, status = 0, http.StatusTooManyRequests
+	if _, err := c.CreateIssue(&jira.Issue{}); err != nil || server.calls != 2 {
+		t.Errorf("Expected a create answered with 429 to be retried: %v, %d calls", err, server.calls)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		<-done
+	})
+	defer server.Close()
+	defer close(done)
+
+	c := newClient(t, server.URL)
+	c.HTTPClient = &http.Client{Timeout: 50 * time.Millisecond}
+	err := c.DeleteIssue("10001")
+	if err == nil || !jira.IsNetworkError(err) {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
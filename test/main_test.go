@@ -2,15 +2,23 @@ package main
 
 import (
 	"jira"
+	"path/filepath"
 	"testing"
 	"todo/cmd"
 	"todo/internal/config"
+	"todo/internal/store"
 )
 
 func TestAddTodo(t *testing.T) {
 	todo := cmd.Todo{}
 	todo.JC = &jira.Client{BaseURL: "1"}
 	todo.Config = &config.Cfg{}
+	f, err := config.Open(filepath.Join(t.TempDir(), "todo.yaml"))
+	if err != nil {
+		t.Fatalf("Could not open config file: %v", err)
+	}
+	defer f.Close()
+	todo.Store = store.NewYAML(f, todo.Config)
 	if err := todo.Add("1", true); err != nil {
 		t.Errorf("Could not create issue: %v", err)
 	}
@@ -18,3 +26,36 @@ func TestAddTodo(t *testing.T) {
 		t.Errorf("Should not be able to create empty issue")
 	}
 }
+
+func TestFindTask(t *testing.T) {
+	todo := cmd.Todo{}
+	todo.Config = &config.Cfg{
+		Tasks: []*config.Task{
+			{ID: 1, Text: "write report"},
+			{ID: 2, Text: "write tests"},
+			{ID: 3, Text: "review PR", JiraKey: "PRJ-42"},
+		},
+		NextID: 3,
+	}
+	f, err := config.Open(filepath.Join(t.TempDir(), "todo.yaml"))
+	if err != nil {
+		t.Fatalf("Could not open config file: %v", err)
+	}
+	defer f.Close()
+	todo.Store = store.NewYAML(f, todo.Config)
+	if err := todo.Complete([]string{"write"}); err == nil {
+		t.Errorf("Ambiguous prefix should not complete a task")
+	}
+	if err := todo.Complete([]string{"write t"}); err != nil || !todo.Config.Tasks[1].Done {
+		t.Errorf("Could not complete task by prefix: %v", err)
+	}
+	if err := todo.Complete([]string{"prj-42"}); err != nil || !todo.Config.Tasks[2].Done {
+		t.Errorf("Could not complete task by Jira key: %v", err)
+	}
+	if err := todo.Del([]string{"1"}); err != nil || len(todo.Config.Tasks) != 2 {
+		t.Errorf("Could not delete task by ID: %v", err)
+	}
+	if err := todo.Oops([]string{"1"}); err == nil {
+		t.Errorf("Deleted task should not be found")
+	}
+}
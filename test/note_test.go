@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"jira"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"todo/cmd"
+	"todo/internal/config"
+	"todo/internal/outbox"
+)
+
+func TestNotesBecomeComments(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: write report", false)
+	s := &flakyStore{tasks: []*config.Task{
+		{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"},
+		{ID: 2, Text: "call mom"},
+	}}
+	todo := newTodo(t, server, s)
+
+	if err := todo.Note([]string{"1"}, "Asked Anna for the numbers"); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Note([]string{"2"}, "Sunday"); err != nil {
+		t.Fatal(err)
+	}
+	comments := server.comments["10001"]
+	if len(comments) != 1 || comments[0].Body != "Asked Anna for the numbers" {
+		t.Fatalf("Expected the note as a comment, got %+v", comments)
+	}
+	notes := s.tasks[0].Notes
+	if len(notes) != 1 || notes[0].CommentID != comments[0].ID || notes[0].Time.IsZero() {
+		t.Errorf("Expected the note to be saved with its comment, got %+v", notes)
+	}
+	if len(s.tasks[1].Notes) != 1 || s.tasks[1].Notes[0].CommentID != "" {
+		t.Errorf("Expected a local note on the offline task, got %+v", s.tasks[1].Notes)
+	}
+	if err := todo.Note([]string{"1"}, "  "); err == nil {
+		t.Errorf("Expected an empty note to be refused")
+	}
+
+	s.broken = true
+	if err := todo.Note([]string{"1"}, "Numbers are in"); err == nil {
+		t.Fatalf("Note should fail when the task can't be saved")
+	}
+	if len(server.comments["10001"]) != 1 {
+		t.Errorf("Expected the comment to be deleted again, got %+v", server.comments["10001"])
+	}
+}
+
+func TestShowMergesNotesAndComments(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: write report", false)
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := newTodo(t, server, s)
+
+	if err := todo.Note([]string{"1"}, "First draft done"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := todo.JC.AddComment("10001", "Looks good"); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	todo.Out = &out
+	todo.Output = "json"
+	if err := todo.Show([]string{"1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	var details cmd.TaskDetails
+	if err := json.Unmarshal(out.Bytes(), &details); err != nil {
+		t.Fatalf("Show did not print json: %v\n%s", err, out.String())
+	}
+	th := details.Thread
+	if len(th) != 2 || th[0].Text != "First draft done" || th[1].Text != "Looks good" || th[1].Author != "Todo User" {
+		t.Errorf("Expected the note once and the comment after it, got %+v", th)
+	}
+
+	// Without Jira the notes are still shown
+	todo.JC.BaseURL = unreachable()
+	out.Reset()
+	todo.Output = ""
+	if err := todo.Show([]string{"1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "First draft done") || strings.Contains(out.String(), "Looks good") {
+		t.Errorf("Expected only the local note, got\n%s", out.String())
+	}
+}
+
+func TestNotesAreQueuedWhileJiraIsDown(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: write report", false)
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := newTodo(t, server, s, withSynced, withOutbox)
+	todo.JC.BaseURL = unreachable()
+
+	if err := todo.Note([]string{"1"}, "Waiting for Anna"); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Note([]string{"1"}, "Got the numbers"); err != nil {
+		t.Fatal(err)
+	}
+	ops := todo.Outbox.Pending()
+	if len(ops) != 2 || ops[0].Kind != outbox.Comment {
+		t.Fatalf("Expected the notes to be queued, got %+v", ops)
+	}
+	todo.JC.BaseURL = server.URL
+	if err := todo.Flush(0); err != nil {
+		t.Fatal(err)
+	}
+	comments := server.comments["10001"]
+	if len(comments) != 2 || comments[0].Body != "Waiting for Anna" || comments[1].Body != "Got the numbers" {
+		t.Errorf("Expected both notes as comments in order, got %+v", comments)
+	}
+	for _, n := range s.tasks[0].Notes {
+		if n.CommentID == "" {
+			t.Errorf("Expected every note to know its comment: %+v", s.tasks[0].Notes)
+		}
+	}
+}
+
+func TestTransitionsAreCommented(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: write report", false)
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := newTodo(t, server, s)
+
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.transitions) != 1 || !strings.Contains(server.transitions[0], `"body":"Closed by Todo"`) {
+		t.Errorf("Expected the transition to carry the comment, got %v", server.transitions)
+	}
+
+	if err := todo.Oops([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.transitions) != 2 || !strings.Contains(server.transitions[1], `"body":"Re-opened by Todo"`) {
+		t.Errorf("Expected the re-opening to carry the comment, got %v", server.transitions)
+	}
+}
+
+func TestTransitionWithoutCommentScreen(t *testing.T) {
+	var requests []string
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		b, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/transitions") && strings.Contains(string(b), "comment"):
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorMessages":[],"errors":{"comment":"Field 'comment' cannot be set. It is not on the appropriate screen, or unknown."}}`)
+		case strings.HasSuffix(r.URL.Path, "/transitions"):
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/comment"):
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id":"1","body":"Closed by Todo"}`)
+		}
+	})
+	defer server.Close()
+	c := newClient(t, server.URL)
+
+	if err := c.ChangeIssueStatus("10001", "31", "Closed by Todo"); err != nil {
+		t.Fatal(err)
+	}
+	want := "POST /rest/api/2/issue/10001/transitions,POST /rest/api/2/issue/10001/transitions,POST /rest/api/2/issue/10001/comment"
+	if got := strings.Join(requests, ","); got != want {
+		t.Errorf("Expected the comment to be added after the transition, got %s", got)
+	}
+}
+
+var comment = regexp.MustCompile(`^/rest/api/2/issue/([^/]+)/comment(?:/([^/]+))?$`)
+
+// comment adds, lists and deletes the comments of an issue
+func (f *fakeJira) comment(w http.ResponseWriter, r *http.Request) {
+	m := comment.FindStringSubmatch(r.URL.Path)
+	issueID, commentID := m[1], m[2]
+	switch r.Method {
+	case "POST":
+		var c jira.Comment
+		json.NewDecoder(r.Body).Decode(&c)
+		f.commentSeq++
+		c.ID = fmt.Sprintf("%d", f.commentSeq)
+		c.Created = time.Now().Format(jira.TimeFormat)
+		c.Author = &jira.User{DisplayName: "Todo User"}
+		f.comments[issueID] = append(f.comments[issueID], c)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+	case "GET":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"startAt": 0, "total": len(f.comments[issueID]), "comments": f.comments[issueID],
+		})
+	case "DELETE":
+		for i, c := range f.comments[issueID] {
+			if c.ID == commentID {
+				f.comments[issueID] = append(f.comments[issueID][:i], f.comments[issueID][i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"jira"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dghubble/oauth1"
+)
+
+// oauthJira stands in for Jira, rejecting requests without a valid RSA-SHA1
+// signature in the Authorization header the way Jira does
+type oauthJira struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// params are the oauth_ parameters of the last request
+	params map[string]string
+	query  url.Values
+}
+
+func newOAuthJira(t *testing.T) *oauthJira {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &oauthJira{key: key}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if problem := s.verify(r); problem != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "oauth_problem=%s", problem)
+			return
+		}
+		switch r.URL.Path {
+		case "/plugins/servlet/oauth/request-token":
+			fmt.Fprint(w, "oauth_token=request-token&oauth_token_secret=secret&oauth_callback_confirmed=true")
+		case "/plugins/servlet/oauth/access-token":
+			fmt.Fprint(w, "oauth_token=access-token&oauth_token_secret=secret")
+		case "/rest/api/2/issue":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id":"10001","key":"PRJ-1"}`)
+		case "/rest/api/2/project/PRJ":
+			fmt.Fprint(w, `{"id":"1","key":"PRJ","name":"Project","issueTypes":[{"id":"3","name":"Task"},{"id":"4","name":"Bug"}]}`)
+		case "/rest/api/2/issue/createmeta":
+			fmt.Fprint(w, `{"projects":[{"key":"PRJ","issuetypes":[{"id":"3","name":"Task"},{"id":"4","name":"Bug"},{"id":"5","name":"Sub-task","subtask":true}]}]}`)
+		case "/rest/api/2/project/PRJ/statuses":
+			fmt.Fprint(w, `[{"id":"3","name":"Task","statuses":[`+
+				`{"id":"1","name":"Backlog","statusCategory":{"key":"new","name":"To Do"}},`+
+				`{"id":"3","name":"In Progress","statusCategory":{"key":"indeterminate","name":"In Progress"}},`+
+				`{"id":"10","name":"Done","statusCategory":{"key":"done","name":"Done"}}]}]`)
+		case "/rest/api/2/search":
+			fmt.Fprint(w, `{"total":1,"issues":[{"id":"10001","key":"PRJ-1","fields":{"issuetype":{"id":"3"}}}]}`)
+		case "/rest/api/2/issue/10001/transitions":
+			fmt.Fprint(w, `{"transitions":[{"id":"11","name":"Backlog","to":{"name":"Backlog"}},{"id":"31","name":"Close","to":{"name":"Done"}}]}`)
+		case "/rest/api/2/project/search":
+			fmt.Fprint(w, `{"total":1,"isLast":true,"values":[{"id":"1","key":"PRJ","name":"Project"}]}`)
+		default:
+			if r.Method == "GET" {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	return s
+}
+
+func (s *oauthJira) config() *oauth1.Config {
+	return &oauth1.Config{
+		ConsumerKey: "Todo",
+		Signer:      &oauth1.RSASigner{PrivateKey: s.key},
+		Endpoint: oauth1.Endpoint{
+			AccessTokenURL: s.URL + "/plugins/servlet/oauth/access-token",
+		},
+	}
+}
+
+// verify returns the oauth_problem of the request, if any
+func (s *oauthJira) verify(r *http.Request) string {
+	params, err := parseAuthorization(r.Header.Get("Authorization"))
+	if err != nil {
+		return "parameter_absent"
+	}
+	s.params, s.query = params, r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	if h, ok := params["oauth_body_hash"]; ok && h != jira.BodyHash(body) {
+		return "body_hash_invalid"
+	}
+	// The request as sent by the client, not as seen by the server
+	r.URL.Scheme, r.URL.Host = "http", r.Host
+	base, err := jira.SignatureBase(r, body, params)
+	if err != nil {
+		return "parameter_rejected"
+	}
+	signature, err := base64.StdEncoding.DecodeString(params["oauth_signature"])
+	if err != nil {
+		return "signature_invalid"
+	}
+	digest := sha1.Sum([]byte(base))
+	if rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA1, digest[:], signature) != nil {
+		return "signature_invalid"
+	}
+	return ""
+}
+
+// parseAuthorization parses an OAuth Authorization header
+func parseAuthorization(header string) (map[string]string, error) {
+	if !strings.HasPrefix(header, "OAuth ") {
+		return nil, fmt.Errorf("Not an OAuth header: %q", header)
+	}
+	params := map[string]string{}
+	for _, pair := range strings.Split(strings.TrimPrefix(header, "OAuth "), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+			return nil, fmt.Errorf("Invalid parameter %q", pair)
+		}
+		var err error
+		if params[k], err = url.PathUnescape(v[1 : len(v)-1]); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+func TestSignatureBase(t *testing.T) {
+	// The example of RFC 5849 section 3.4.1.1
+	req, _ := http.NewRequest("POST", "http://EXAMPLE.COM:80/request?b5=%3D%253D&a3=a&c%40=&a2=r%20b", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	base, err := jira.SignatureBase(req, []byte("c2&a3=2+q"), map[string]string{
+		"realm":                  "Example",
+		"oauth_consumer_key":     "9djdj82h48djs9d2",
+		"oauth_token":            "kkk9d7dh3k39sjv7",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "137131201",
+		"oauth_nonce":            "7d8f3e4a",
+		"oauth_signature":        "djosJKDKJSD8743243/jdk33klY=",
+	})
+	want := "POST&http%3A%2F%2Fexample.com%2Frequest&a2%3Dr%2520b%26a3%3D2%2520q" +
+		"%26a3%3Da%26b5%3D%253D%25253D%26c%2540%3D%26c2%3D%26oauth_consumer_key" +
+		"%3D9djdj82h48djs9d2%26oauth_nonce%3D7d8f3e4a%26oauth_signature_method" +
+		"%3DHMAC-SHA1%26oauth_timestamp%3D137131201%26oauth_token%3Dkkk9d7dh3k39sjv7"
+	if err != nil || base != want {
+		t.Errorf("Expected\n%s\ngot\n%s %v", want, base, err)
+	}
+	// The HMAC-SHA1 example of RFC 5849 section 1.2
+	req, _ = http.NewRequest("GET", "http://photos.example.net/photos?file=vacation.jpg&size=original", nil)
+	base, _ = jira.SignatureBase(req, nil, map[string]string{
+		"oauth_consumer_key":     "dpf43f3p2l4k3l03",
+		"oauth_token":            "nnch734d00sl2jdk",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "137131202",
+		"oauth_nonce":            "chapoH",
+	})
+	signature, _ := (&oauth1.HMACSigner{ConsumerSecret: "kd94hf93k423kf44"}).Sign("pfkkdhi9sl3r4s00", base)
+	if signature != "MdpQcU8iPSUjWoN/UDMsK2sui9I=" {
+		t.Errorf("Expected the signature of the RFC, got %s for\n%s", signature, base)
+	}
+}
+
+func TestBodyHash(t *testing.T) {
+	// The examples of the OAuth Request Body Hash extension
+	if h := jira.BodyHash([]byte("Hello World!")); h != "Lve95gjOVATpfV8EL5X4nxwjKHE=" {
+		t.Errorf("Unexpected body hash %s", h)
+	}
+	if h := jira.BodyHash(nil); h != "2jmj7l5rSw0yVb/vlWAYkK/YBwk=" {
+		t.Errorf("Unexpected hash of an empty body %s", h)
+	}
+}
+
+func TestOAuthSignedRequests(t *testing.T) {
+	server := newOAuthJira(t)
+	defer server.Close()
+	c := jira.NewClient(server.config())
+	c.BaseURL = server.URL
+	if err := c.AccessToken("request-token"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "access-token" || server.params["oauth_token"] != "request-token" {
+		t.Errorf("Expected the access token for the request token: %v", server.params)
+	}
+
+	if _, err := c.CreateIssue(&jira.Issue{Fields: jira.Fields{Summary: "TODO: write report"}}); err != nil {
+		t.Errorf("The body should be signed through its hash: %v", err)
+	}
+	if server.params["oauth_token"] != "access-token" || server.params["oauth_body_hash"] == "" {
+		t.Errorf("Unexpected oauth parameters %v", server.params)
+	}
+	if projects, err := c.ListProjects(); err != nil || len(projects) != 1 {
+		t.Errorf("The query should be signed: %v %v", projects, err)
+	}
+	if server.query.Get("oauth_signature") != "" {
+		t.Errorf("Nothing should be added to the query: %v", server.query)
+	}
+
+	// Query parameters that need encoding, repeated ones and a body
+	auth := &jira.OAuth1{Config: server.config(), Token: "access-token"}
+	body := []byte(`{"comment":"50% done & more"}`)
+	req, _ := http.NewRequest("PUT", server.URL+"/rest/api/2/issue/10001?expand=a,b&q=x+y%2Bz&q=%E2%9C%93&empty=", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if err := auth.Authenticate(req, body); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected the signature to be accepted, got %d", resp.StatusCode)
+	}
+
+	// A body that was changed after signing is rejected
+	req, _ = http.NewRequest("PUT", server.URL+"/rest/api/2/issue/10001", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Content-Type", "application/json")
+	auth.Authenticate(req, body)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a changed body to be rejected, got %d", resp.StatusCode)
+	}
+}
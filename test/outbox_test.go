@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+	"todo/cmd"
+	"todo/internal/config"
+	"todo/internal/outbox"
+)
+
+func TestOutboxQueuesWhileJiraIsDown(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("9001", "PRJ-1", "TODO: old report", false)
+	server.issue("9002", "PRJ-2", "TODO: review PR", false)
+	s := &flakyStore{tasks: []*config.Task{
+		{ID: 1, Text: "old report", JiraID: "9001", JiraKey: "PRJ-1"},
+		{ID: 2, Text: "review PR", JiraID: "9002", JiraKey: "PRJ-2"},
+	}}
+	todo := newTodo(t, server, s, withSynced, withOutbox)
+	todo.JC.BaseURL = unreachable()
+
+	if err := todo.Add("write report", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Del([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.tasks) != 2 || s.tasks[1].Text != "write report" || s.tasks[1].JiraKey != "" {
+		t.Fatalf("Changes should be saved locally right away: %+v", s.tasks)
+	}
+	// Jira is reachable again, but the completion has to wait for the queue
+	todo.JC.BaseURL = server.URL
+	if err := todo.Complete([]string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.tasks[0].Done || server.remote["9002"].Done() {
+		t.Errorf("The completion should be queued behind the earlier changes")
+	}
+	if err := todo.Sync(cmd.PreferSkip); err == nil {
+		t.Errorf("Sync should refuse to run while changes are queued")
+	}
+	kinds := []string{}
+	for _, op := range todo.Outbox.Pending() {
+		kinds = append(kinds, op.Kind)
+	}
+	if len(kinds) != 3 || kinds[0] != outbox.Create || kinds[1] != outbox.Delete || kinds[2] != outbox.Transition {
+		t.Fatalf("Expected create, delete and transition to be queued, got %v", kinds)
+	}
+
+	if err := todo.Flush(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.remote["9001"]; ok {
+		t.Errorf("The queued delete was not sent")
+	}
+	task := s.tasks[1]
+	if task.JiraKey != "PRJ-1" || server.remote[task.JiraID].Fields.Summary != "TODO: write report" {
+		t.Errorf("The task should be linked to the created issue: %+v", task)
+	}
+	if !server.remote["9002"].Done() {
+		t.Errorf("The queued transition was not sent")
+	}
+	if len(todo.Outbox.Ops()) != 0 {
+		t.Errorf("The outbox should be empty: %+v", todo.Outbox.Ops())
+	}
+}
+
+func TestOutboxRetriesAndCoalesces(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{}
+	todo := newTodo(t, server, s, withSynced, withOutbox)
+	todo.JC.BaseURL = unreachable()
+
+	if err := todo.Add("write report", false); err != nil {
+		t.Fatal(err)
+	}
+	// Changes to a task that is still to be created are sent with it
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Add("review PR", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Del([]string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(todo.Outbox.Ops()); n != 1 {
+		t.Fatalf("Expected only the first create to be queued, got %d ops", n)
+	}
+
+	if err := todo.Flush(0); err == nil {
+		t.Fatalf("Flush should fail while Jira is down")
+	}
+	op := todo.Outbox.Ops()[0]
+	if op.Attempts != 1 || op.NextTry.IsZero() || op.Error == "" {
+		t.Errorf("The failed attempt should be recorded: %+v", op)
+	}
+	if outbox.Backoff(1) >= outbox.Backoff(2) || outbox.Backoff(20) != outbox.Backoff(30) {
+		t.Errorf("Backoff should grow up to a limit")
+	}
+
+	todo.JC.BaseURL = server.URL
+	if err := todo.Flush(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.remote) != 1 || s.tasks[0].JiraID == "" || !server.remote[s.tasks[0].JiraID].Done() {
+		t.Errorf("The completed task should be created as done: %+v %v", s.tasks[0], server.remote)
+	}
+}
+
+func TestOutboxRejectedChanges(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.fail["POST /rest/api/2/issue"] = true
+	s := &flakyStore{}
+	todo := newTodo(t, server, s, withSynced, withOutbox)
+
+	// Jira answering with an error is not queued
+	if err := todo.Add("write report", false); err == nil || len(s.tasks) != 0 {
+		t.Fatalf("Add should fail when Jira rejects it: %v", err)
+	}
+	todo.JC.BaseURL = unreachable()
+	if err := todo.Add("write report", false); err != nil {
+		t.Fatal(err)
+	}
+	todo.JC.BaseURL = server.URL
+	if err := todo.Flush(0); err == nil {
+		t.Fatalf("Flush should report rejected changes")
+	}
+	if ops := todo.Outbox.Ops(); len(ops) != 1 || !ops[0].Failed || len(todo.Outbox.Pending()) != 0 {
+		t.Errorf("The rejected change should be kept as failed: %+v", ops)
+	}
+
+	// Changes rejected before are not reported by the next flush
+	todo.JC.BaseURL = unreachable()
+	if err := todo.Add("call mom", false); err != nil {
+		t.Fatal(err)
+	}
+	todo.JC.BaseURL = server.URL
+	delete(server.fail, "POST /rest/api/2/issue")
+	if err := todo.Flush(0); err != nil {
+		t.Errorf("Expected only the new change to be reported, got %v", err)
+	}
+	if err := todo.Discard(); err != nil || len(todo.Outbox.Ops()) != 0 {
+		t.Errorf("Discard should remove rejected changes: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"todo/cmd"
+)
+
+func TestOutputFormats(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{}
+	todo := newTodo(t, server, s)
+	todo.Config.Jira.URL = "https://jira.company.com"
+	var out bytes.Buffer
+	todo.Out = &out
+
+	todo.Output = "json"
+	if err := todo.Add("write report", false); err != nil {
+		t.Fatal(err)
+	}
+	var added cmd.TaskOutput
+	if err := json.Unmarshal(out.Bytes(), &added); err != nil {
+		t.Fatalf("Add did not print the task as json: %v\n%s", err, out.String())
+	}
+	if added.ID != 1 || added.JiraKey != "PRJ-1" || added.URL != "https://jira.company.com/browse/PRJ-1" {
+		t.Errorf("Unexpected task printed by add: %+v", added)
+	}
+
+	out.Reset()
+	todo.Add("write tests", true)
+	todo.Output = "csv"
+	out.Reset()
+	if err := todo.List(cmd.ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "id" || rows[1][3] != "write report" || rows[2][9] != "" {
+		t.Errorf("Unexpected csv output: %v", rows)
+	}
+
+	todo.Output = "template"
+	todo.Template = "{{.ID}} {{.JiraKey}} {{.URL}}"
+	out.Reset()
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "1 PRJ-1 https://jira.company.com/browse/PRJ-1" {
+		t.Errorf("Unexpected template output: %s", got)
+	}
+
+	todo.Output = "yaml"
+	out.Reset()
+	if err := todo.List(cmd.ListOptions{Filter: "done"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "- id: 1\n") || !strings.Contains(out.String(), "done: true") ||
+		strings.Contains(out.String(), "write tests") {
+		t.Errorf("Unexpected yaml output:\n%s", out.String())
+	}
+
+	todo.Output = "xml"
+	if err := todo.List(cmd.ListOptions{}); err == nil {
+		t.Errorf("Unknown output formats should be rejected")
+	}
+	todo.Output = "table"
+	out.Reset()
+	if err := todo.List(cmd.ListOptions{Filter: "open"}); err != nil || !strings.Contains(out.String(), "write tests") {
+		t.Errorf("Unexpected table output: %v\n%s", err, out.String())
+	}
+}
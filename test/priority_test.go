@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"todo/internal/config"
+)
+
+func TestParsePriority(t *testing.T) {
+	tests := map[string]string{
+		"!high":   "High",
+		"HIGHEST": "Highest",
+		"a":       "Highest",
+		"!e":      "Lowest",
+		"3":       "Medium",
+		"none":    "",
+		"":        "",
+	}
+	for in, want := range tests {
+		got, err := config.ParsePriority(in)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s (%v)", in, want, got, err)
+		}
+	}
+	if _, err := config.ParsePriority("urgent"); err == nil {
+		t.Errorf("Unknown priorities should be rejected")
+	}
+}
+
+func TestTagsAndPrioritySyncToJira(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{}
+	todo := newTodo(t, server, s)
+
+	task := &config.Task{Text: "fix login", Tags: []string{"backend", "@office"}, Priority: "High"}
+	if err := todo.AddTask(task, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.created) != 1 ||
+		!strings.Contains(server.created[0], `"labels":["backend","@office"]`) ||
+		!strings.Contains(server.created[0], `"priority":{"name":"High"}`) {
+		t.Errorf("Tags and priority were not sent to Jira: %v", server.created)
+	}
+	err := todo.Edit([]string{"1"}, func(task *config.Task) error {
+		task.Tags = task.Tags[:1]
+		task.Priority = "Low"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.updates) != 1 ||
+		!strings.Contains(server.updates[0], `"labels":["backend"]`) ||
+		!strings.Contains(server.updates[0], `"priority":{"name":"Low"}`) {
+		t.Errorf("Changed tags and priority were not sent to Jira: %v", server.updates)
+	}
+}
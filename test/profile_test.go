@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"todo/cmd"
+	"todo/internal/config"
+)
+
+// newProfileTodo returns a todo using home as the default profile, with a
+// second profile "work" for work
+func newProfileTodo(t *testing.T, home, work *fakeJira, s *flakyStore) *cmd.Todo {
+	todo := newTodo(t, home, s, withSynced, withConfigFile)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo.PrivateKey = key
+	token, err := config.Encrypt(&key.PublicKey, "work-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo.Config.Jira.URL = home.URL
+	todo.Config.Profiles = map[string]*config.Jira{"work": {
+		URL:     work.URL,
+		Auth:    config.AuthPAT,
+		Token:   token,
+		Project: config.Project{Key: "OPS", ID: "2", DoneID: "31", BacklogID: "11"},
+	}}
+	return todo
+}
+
+func TestTasksStayWithTheirProfile(t *testing.T) {
+	home := newFakeJira()
+	defer home.Close()
+	work := newFakeJira()
+	defer work.Close()
+	s := &flakyStore{}
+	todo := newProfileTodo(t, home, work, s)
+	homeClient := todo.JC
+
+	if err := todo.Add("water plants", false); err != nil {
+		t.Fatal(err)
+	}
+	// As with --profile work
+	todo.Profile = "work"
+	todo.JC = newClient(t, work.URL)
+	if err := todo.Add("review PR", false); err != nil {
+		t.Fatal(err)
+	}
+	task := s.tasks[1]
+	if task.Profile != "work" || task.Project != "OPS" || len(work.created) != 1 || !strings.Contains(work.created[0], `"id":"2"`) {
+		t.Fatalf("The task should be created in the work project: %+v %v", task, work.created)
+	}
+
+	// Both issues have ID 10001, each in its own Jira
+	todo.Profile = ""
+	todo.JC = homeClient
+	if err := todo.Complete([]string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+	if !work.remote["10001"].Done() || home.remote["10001"].Done() {
+		t.Errorf("The issue should be closed in the Jira of its profile")
+	}
+	if err := todo.Sync(cmd.PreferSkip); err != nil {
+		t.Fatal(err)
+	}
+	if !s.tasks[1].Done || s.tasks[0].Done || !work.called("POST /rest/api/2/search") {
+		t.Errorf("Sync should look up every task in its own Jira: %+v", s.tasks)
+	}
+
+	if err := todo.RemoveProfile("work"); err == nil {
+		t.Errorf("A profile tasks are linked to should be kept")
+	}
+	if err := todo.UseProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := todo.ConfigFile.Read(); err != nil || cfg.Profile != "work" {
+		t.Errorf("Expected work to be saved as the default profile: %v", err)
+	}
+	if err := todo.Del([]string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(work.remote) != 0 || len(home.remote) != 1 {
+		t.Errorf("The issue should be deleted in the Jira of its profile")
+	}
+	if err := todo.RemoveProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	if todo.Config.Profile != "" || len(todo.Config.Profiles) != 0 {
+		t.Errorf("Expected the profile to be gone: %+v", todo.Config)
+	}
+	if err := todo.RemoveProfile("default"); err == nil {
+		t.Errorf("The default profile can't be removed")
+	}
+}
+
+// runTodo runs the todo command line with args in a new process, with home
+// as $HOME
+func runTodo(t *testing.T, home string, args ...string) (string, error) {
+	c := exec.Command(os.Args[0], append([]string{"-test.run=^TestRunTodo$", "--"}, args...)...)
+	c.Env = append(os.Environ(), "TODO_RUN_MAIN=1", "HOME="+home)
+	out, err := c.CombinedOutput()
+	return string(out), err
+}
+
+// TestRunTodo is the command line when started by runTodo
+func TestRunTodo(t *testing.T) {
+	if os.Getenv("TODO_RUN_MAIN") != "1" {
+		return
+	}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			os.Args = append([]string{"todo"}, os.Args[i+1:]...)
+			break
+		}
+	}
+	cmd.Execute()
+	os.Exit(0)
+}
+
+func TestUnknownProfileIsRefused(t *testing.T) {
+	home := t.TempDir()
+	dir := filepath.Join(home, ".config", "todo")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "todo.yaml"), []byte("tasks: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{"--profile", "typo", "list"}, {"--profile", "typo", "pull"}} {
+		out, err := runTodo(t, home, args...)
+		if err == nil || !strings.Contains(out, "No profile named 'typo'") || strings.Contains(out, "panic") {
+			t.Errorf("Expected todo %s to refuse the profile, got %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	if out, err := runTodo(t, home, "--profile", "typo", "profile", "list"); err != nil {
+		t.Errorf("Expected the profiles to be listed, got %v\n%s", err, out)
+	}
+
+	// Words of the task text don't make it a profile command
+	if err := ioutil.WriteFile(filepath.Join(dir, "todo.yaml"), []byte("profile: typo\ntasks: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runTodo(t, home, "add", "init", "profile", "--offline")
+	if err == nil || !strings.Contains(out, "No profile named 'typo'") {
+		t.Errorf("Expected the profile in use to be refused, got %v\n%s", err, out)
+	}
+}
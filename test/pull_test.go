@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"jira"
+	"strings"
+	"testing"
+	"time"
+	"todo/cmd"
+	"todo/internal/config"
+)
+
+func TestPull(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	// More than two pages
+	for i := 1; i <= 250; i++ {
+		server.issue(fmt.Sprintf("%d", 20000+i), fmt.Sprintf("PRJ-%d", 100+i), fmt.Sprintf("Issue %d", i), false)
+	}
+	first := server.remote["20001"]
+	first.Fields.DueDate = "2018-05-04"
+	first.Fields.Labels = []string{"backend"}
+	first.Fields.Priority = &jira.Priority{Name: "High"}
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "Issue 2", JiraID: "20002", JiraKey: "PRJ-102"}}}
+	todo := newTodo(t, server, s, withSynced)
+	todo.Config.Jira.Project.Key = "PRJ"
+
+	if err := todo.Pull(""); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.tasks) != 250 {
+		t.Fatalf("Expected 249 issues to be added to the one task, got %d tasks", len(s.tasks))
+	}
+	searches := 0
+	for _, r := range server.requests {
+		if r == "POST /rest/api/2/search" {
+			searches++
+		}
+	}
+	if searches != 3 {
+		t.Errorf("Expected 3 pages to be fetched, got %d", searches)
+	}
+	task := s.tasks[1]
+	due := time.Date(2018, 5, 4, 23, 59, 59, 0, time.Local)
+	if task.JiraKey != "PRJ-101" || task.Text != "Issue 1" || !task.Due.Equal(due) ||
+		task.Priority != "High" || !task.HasTag("backend") {
+		t.Errorf("Issue fields were not copied to the task: %+v", task)
+	}
+	if _, ok := todo.Synced.Get(task.ID); !ok {
+		t.Errorf("Pulled tasks should be marked as synced")
+	}
+
+	if err := todo.Pull(`project = PRJ AND labels = "backend"`); err != nil || len(s.tasks) != 250 {
+		t.Errorf("Pulling again should not add anything: %v, %d tasks", err, len(s.tasks))
+	}
+	if len(server.created) != 0 || len(server.updates) != 0 {
+		t.Errorf("Pulling should not change Jira: %v %v", server.created, server.updates)
+	}
+}
+
+func TestPullWithoutJira(t *testing.T) {
+	todo := &cmd.Todo{Config: &config.Cfg{}, Store: &flakyStore{}}
+	if err := todo.Pull(""); err == nil || !strings.Contains(err.Error(), "todo init") {
+		t.Errorf("Expected to be told to run 'todo init', got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"todo/internal/config"
+	"todo/internal/query"
+)
+
+func TestQueryMatch(t *testing.T) {
+	// A Wednesday afternoon
+	now := time.Date(2018, 5, 2, 14, 30, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2018, 5, d, 23, 59, 59, 0, time.UTC) }
+	tasks := []*config.Task{
+		{ID: 1, Text: "Fix login page", Tags: []string{"backend", "@office"}, Priority: "High", Due: day(4), JiraKey: "PRJ-1"},
+		{ID: 2, Text: "Write report", Done: true, Due: day(1), Completed: now},
+		{ID: 3, Text: "Review login tests", Tags: []string{"qa"}, Priority: "Low", Due: day(1)},
+		{ID: 4, Text: "Plan sprint", Start: time.Date(2018, 5, 7, 0, 0, 0, 0, time.UTC), Due: day(20), Priority: "Highest"},
+	}
+	filters := map[string]string{
+		"work":   "open and (tag:backend or tag:qa)",
+		"urgent": "@work and pri>=high",
+	}
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"", []int{1, 2, 3, 4}},
+		{"all", []int{1, 2, 3, 4}},
+		{"open", []int{1, 3, 4}},
+		{"done", []int{2}},
+		{"completed", []int{2}},
+		{"not open", []int{2}},
+		{"!open", []int{2}},
+		{"linked", []int{1}},
+		{"overdue", []int{3}},
+		{"started", []int{1, 2, 3}},
+		{"tag:backend", []int{1}},
+		{"+backend", []int{1}},
+		{"tag:BACKEND", []int{1}},
+		{"tag:@office", []int{1}},
+		{"tag!=backend", []int{2, 3, 4}},
+		{"tag~^back", []int{1}},
+		{"text:login", []int{1, 3}},
+		{`text~"login (page|form)"`, []int{1}},
+		{`text="write report"`, []int{2}},
+		{"text!='write report'", []int{1, 3, 4}},
+		{"key:prj-1", []int{1}},
+		{"key:none", []int{2, 3, 4}},
+		{"key!=none", []int{1}},
+		{"id>2", []int{3, 4}},
+		{"id<=2", []int{1, 2}},
+		{"pri:high", []int{1}},
+		{"pri>=high", []int{1, 4}},
+		{"pri>high", []int{4}},
+		{"pri<medium", []int{3}},
+		{"pri:none", []int{2}},
+		{"pri!=high", []int{2, 3, 4}},
+		{"due:today", nil},
+		{"due=fri", []int{1}},
+		{"due<today", []int{2, 3}},
+		{"due<=fri", []int{1, 2, 3}},
+		{"due>fri", []int{4}},
+		{"due<7d", []int{1, 2, 3}},
+		{"due<2018-05-03", []int{2, 3}},
+		{"due:none", nil},
+		{"start:none", []int{1, 2, 3}},
+		{"start>=mon", []int{4}},
+		{"completed:today", []int{2}},
+		{"open and tag:backend and due<7d and text~\"login\"", []int{1}},
+		{"open and (tag:qa or pri:highest)", []int{3, 4}},
+		{"open and tag:qa or pri:highest", []int{3, 4}},
+		{"done or tag:qa and pri:low", []int{2, 3}},
+		{"not (open or linked)", []int{2}},
+		{"OPEN AND NOT linked", []int{3, 4}},
+		{"@work", []int{1, 3}},
+		{"@urgent", []int{1}},
+		{"@work and not @urgent", []int{3}},
+	}
+	for _, test := range tests {
+		e, err := query.Parse(test.query, now, filters)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.query, err)
+			continue
+		}
+		var got []int
+		for _, task := range tasks {
+			if e.Match(task) {
+				got = append(got, task.ID)
+			}
+		}
+		if !equalIDs(got, test.want) {
+			t.Errorf("%s (%s): expected %v, got %v", test.query, e, test.want, got)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	now := time.Date(2018, 5, 2, 14, 30, 0, 0, time.UTC)
+	filters := map[string]string{
+		"loop":   "open and @loop",
+		"broken": "tag:",
+	}
+	tests := []struct {
+		query string
+		msg   string
+		pos   int
+	}{
+		{"open and", "unexpected end of filter", 8},
+		{"open tag:x", "expected 'and', 'or'", 5},
+		{"(open or done", "expected ')'", 13},
+		{"open)", "expected 'and', 'or'", 4},
+		{"opne", "unknown keyword 'opne'", 0},
+		{"size>3", "unknown field 'size'", 0},
+		{"due", "expected an operator after 'due'", 3},
+		{"tag<x", "operator '<' can't be used with tag", 3},
+		{"tag:", "expected a value after 'tag:'", 4},
+		{"due<someday", "invalid date 'someday'", 4},
+		{"pri>urgent", "unknown priority 'urgent'", 4},
+		{"pri>none", "'none' can only be used with", 4},
+		{"id=abc", "'abc' is not a task ID", 3},
+		{"text~\"(\"", "invalid regular expression", 5},
+		{"text:\"login", "missing closing quote", 5},
+		{"and open", "unknown keyword 'and'", 0},
+		{"@nope", "no saved filter named 'nope'", 0},
+		{"@loop", "saved filter 'loop' refers to itself", 9},
+		{"open and @broken", "in saved filter 'broken': expected a value", 4},
+	}
+	for _, test := range tests {
+		_, err := query.Parse(test.query, now, filters)
+		e, ok := err.(*query.Error)
+		if !ok {
+			t.Errorf("%s: expected *query.Error, got %v", test.query, err)
+			continue
+		}
+		if !strings.Contains(e.Msg, test.msg) || e.Pos != test.pos {
+			t.Errorf("%s: expected '%s' at %d, got '%s' at %d", test.query, test.msg, test.pos, e.Msg, e.Pos)
+		}
+	}
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
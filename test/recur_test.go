@@ -0,0 +1,233 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"todo/internal/config"
+	"todo/internal/journal"
+	"todo/internal/recur"
+	"todo/internal/when"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	// A Wednesday afternoon
+	now := time.Date(2018, 5, 2, 14, 30, 0, 0, time.UTC)
+	day := func(m time.Month, d int) time.Time { return time.Date(2018, m, d, 14, 30, 0, 0, time.UTC) }
+	tests := []struct {
+		in, rule    string
+		first, next time.Time
+	}{
+		{"fri", "FREQ=WEEKLY;BYDAY=FR", day(5, 4), day(5, 11)},
+		{"Mon, Wed", "FREQ=WEEKLY;BYDAY=MO,WE", day(5, 2), day(5, 7)},
+		{"weekdays", "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", day(5, 2), day(5, 3)},
+		{"daily", "FREQ=DAILY", now, day(5, 3)},
+		{"2w", "FREQ=WEEKLY;INTERVAL=2", now, day(5, 16)},
+		{"3 days", "FREQ=DAILY;INTERVAL=3", now, day(5, 5)},
+		{"month", "FREQ=MONTHLY", now, day(6, 2)},
+		{"1st", "FREQ=MONTHLY;BYMONTHDAY=1", day(6, 1), day(7, 1)},
+		{"last", "FREQ=MONTHLY;BYMONTHDAY=-1", day(5, 31), day(6, 30)},
+		{"yearly", "FREQ=YEARLY", now, time.Date(2019, 5, 2, 14, 30, 0, 0, time.UTC)},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", day(5, 2), day(5, 14)},
+		{"freq=monthly;bymonthday=31", "FREQ=MONTHLY;BYMONTHDAY=31", day(5, 31), day(6, 30)},
+	}
+	for _, test := range tests {
+		r, err := recur.Parse(test.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.in, err)
+			continue
+		}
+		if r.String() != test.rule {
+			t.Errorf("Parse(%q) = %s, want %s", test.in, r, test.rule)
+		}
+		first := r.First(now)
+		if !first.Equal(test.first) {
+			t.Errorf("%q first occurs %v, want %v", test.in, first, test.first)
+		}
+		if next := r.Next(first); !next.Equal(test.next) {
+			t.Errorf("%q occurs after %v on %v, want %v", test.in, first, next, test.next)
+		}
+	}
+
+	// A short month doesn't move the day of the following ones
+	r, _ := recur.Parse("FREQ=MONTHLY;BYMONTHDAY=31")
+	feb := r.Next(time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC))
+	if mar := r.Next(feb); feb.Day() != 28 || mar.Day() != 31 {
+		t.Errorf("Expected Feb 28 and Mar 31, got %v and %v", feb, mar)
+	}
+
+	// Feb 29 comes back in leap years
+	r, _ = recur.Parse("FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29")
+	next := time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)
+	for _, want := range []int{28, 28, 28, 29} {
+		if next = r.Next(next); next.Month() != time.February || next.Day() != want {
+			t.Errorf("Expected February %d, got %v", want, next)
+		}
+	}
+	if r.Describe() != "every year on the 29th of February" {
+		t.Errorf("Unexpected description %q", r.Describe())
+	}
+
+	for _, in := range []string{"", "sometimes", "0w", "32nd", "FREQ=HOURLY", "FREQ=DAILY;BYDAY=MO", "FREQ=WEEKLY;COUNT=3",
+		"FREQ=YEARLY;BYMONTH=2", "FREQ=MONTHLY;BYMONTH=2", "FREQ=YEARLY;BYMONTH=13;BYMONTHDAY=1"} {
+		if _, err := recur.Parse(in); err == nil {
+			t.Errorf("Expected %q to be refused", in)
+		}
+	}
+}
+
+func TestCompleteAddsNextOccurrence(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10100", "PRJ-100", "TODO: weekly report", false)
+	today := when.EndOfDay(time.Now())
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "weekly report", JiraID: "10100", JiraKey: "PRJ-100",
+		Tags: []string{"reports"}, Due: today.AddDate(0, 0, -21), Recur: &config.Recurrence{Rule: "FREQ=WEEKLY"}}}}
+	todo := newTodo(t, server, s)
+
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.tasks[0].Done || server.remote["10100"].Fields.Status.Name != "Done" {
+		t.Errorf("Expected the occurrence and its issue to be done: %+v", s.tasks[0])
+	}
+	if len(s.tasks) != 2 {
+		t.Fatalf("Expected the next occurrence to be added, got %d tasks", len(s.tasks))
+	}
+	next := s.tasks[1]
+	if next.Done || next.Text != "weekly report" || next.Recur == nil || next.Recur.Rule != "FREQ=WEEKLY" || !next.HasTag("reports") {
+		t.Errorf("Unexpected next occurrence %+v", next)
+	}
+	if !next.Due.Equal(today) {
+		t.Errorf("Expected missed occurrences to be skipped, next is due %v", next.Due)
+	}
+	if len(server.created) != 1 || next.JiraKey != "PRJ-1" || next.JiraID != "10001" {
+		t.Errorf("Expected a new issue for the next occurrence, got %+v %v", next, server.created)
+	}
+	if !strings.Contains(server.created[0], `"duedate":"`+today.Format("2006-01-02")+`"`) {
+		t.Errorf("Expected the new issue to be due with the occurrence, got %s", server.created[0])
+	}
+	if s.tasks[0].Recur != nil {
+		t.Errorf("Expected only the next occurrence to recur, got %+v", s.tasks[0].Recur)
+	}
+}
+
+func TestUndoCompleteRemovesNextOccurrence(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10100", "PRJ-100", "TODO: weekly report", false)
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "weekly report", JiraID: "10100", JiraKey: "PRJ-100",
+		Due: when.EndOfDay(time.Now()), Recur: &config.Recurrence{Rule: "FREQ=WEEKLY"}}}}
+	todo := newTodo(t, server, s)
+	todo.Journal = journal.Open(filepath.Join(t.TempDir(), "todo.journal"))
+
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	// The completed occurrence no longer recurs
+	if err := todo.Oops([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.tasks) != 2 || len(server.created) != 1 {
+		t.Fatalf("Expected one next occurrence, got %d tasks and %d issues", len(s.tasks), len(server.created))
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := todo.Undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.tasks) != 1 || s.tasks[0].Done || s.tasks[0].Recur == nil || !server.called("DELETE /rest/api/2/issue/10001") {
+		t.Fatalf("Expected the undo of the complete to remove the next occurrence and its issue: %+v", s.tasks)
+	}
+	if err := todo.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.tasks) != 2 || !s.tasks[0].Done || s.tasks[0].Recur != nil || s.tasks[1].Recur == nil || s.tasks[1].JiraKey == "" {
+		t.Errorf("Expected the redo to complete the task and add the next occurrence again: %+v", s.tasks)
+	}
+}
+
+func TestCompleteReopensOccurrence(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: invoice", false)
+	due := time.Date(2026, 9, 30, 17, 0, 0, 0, time.Local)
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "invoice", JiraID: "10001", JiraKey: "PRJ-1",
+		Due: due, Start: due.AddDate(0, 0, -2), Recur: &config.Recurrence{Rule: "FREQ=MONTHLY;BYMONTHDAY=-1", Reopen: true}}}}
+	todo := newTodo(t, server, s)
+
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	task := s.tasks[0]
+	if len(s.tasks) != 1 || task.Done || task.Completed.IsZero() {
+		t.Fatalf("Expected the task to stay open for the next occurrence: %+v", s.tasks)
+	}
+	// The last day of the month is never before today
+	y, m, _ := time.Now().Date()
+	if want := time.Date(y, m+1, 0, 17, 0, 0, 0, time.Local); !task.Due.Equal(want) {
+		t.Errorf("Expected the task to be due %v, got %v", want, task.Due)
+	}
+	if !task.Start.Equal(task.Due.AddDate(0, 0, -2)) {
+		t.Errorf("Expected the start date to move with the due date, got %v", task.Start)
+	}
+	if len(server.transitions) != 2 || server.remote["10001"].Fields.Status.Name != "To Do" {
+		t.Errorf("Expected the issue to be closed and re-opened, got %v", server.transitions)
+	}
+	if len(server.created) != 0 || len(server.updates) != 1 || !strings.Contains(server.updates[0], task.Due.Format("2006-01-02")) {
+		t.Errorf("Expected the due date of the issue to be updated, got %v", server.updates)
+	}
+}
+
+func TestAddRecurringTask(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{}
+	todo := newTodo(t, server, s)
+
+	task := &config.Task{Text: "standup", Recur: &config.Recurrence{Rule: "fri"}}
+	if err := todo.AddTask(task, true); err != nil {
+		t.Fatal(err)
+	}
+	friday, _ := when.Due("fri", time.Now())
+	if task.Recur.Rule != "FREQ=WEEKLY;BYDAY=FR" || !task.Due.Equal(friday) {
+		t.Errorf("Expected the rule as an RRULE and the task due on Friday, got %+v", task)
+	}
+	invoice := &config.Task{Text: "invoice", Due: time.Date(2027, 1, 31, 17, 0, 0, 0, time.Local),
+		Recur: &config.Recurrence{Rule: "monthly"}}
+	if err := todo.AddTask(invoice, true); err != nil {
+		t.Fatal(err)
+	}
+	if invoice.Recur.Rule != "FREQ=MONTHLY;BYMONTHDAY=31" {
+		t.Errorf("Expected a monthly rule to keep the day it is due, got %s", invoice.Recur.Rule)
+	}
+	leap := &config.Task{Text: "birthday", Due: time.Date(2028, 2, 29, 17, 0, 0, 0, time.Local),
+		Recur: &config.Recurrence{Rule: "yearly"}}
+	if err := todo.AddTask(leap, true); err != nil {
+		t.Fatal(err)
+	}
+	if leap.Recur.Rule != "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29" {
+		t.Errorf("Expected a yearly rule to keep the day it is due, got %s", leap.Recur.Rule)
+	}
+	if err := todo.AddTask(&config.Task{Text: "never", Recur: &config.Recurrence{Rule: "sometimes"}}, true); err == nil {
+		t.Errorf("Expected an invalid rule to be refused")
+	}
+
+	if err := todo.Edit([]string{"1"}, func(task *config.Task) error {
+		task.Recur = nil
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.tasks) != 3 {
+		t.Errorf("Expected a task that no longer recurs to be completed only, got %d tasks", len(s.tasks))
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"jira"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"todo/cmd"
+	"todo/internal/config"
+	"todo/internal/issuecache"
+)
+
+func TestGetIssueFindsSprints(t *testing.T) {
+	sprints := map[string]string{
+		// Jira Cloud
+		"10001": `[{"id":1,"name":"Sprint 1","state":"closed"},{"id":2,"name":"Sprint 2","state":"active"}]`,
+		// Jira Server and Data Center
+		"10002": `["com.atlassian.greenhopper.service.sprint.Sprint@1f39[id=7,rapidViewId=3,state=CLOSED,name=Sprint 7,goal=]"]`,
+		"10003": `null`,
+	}
+	server := newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		id := filepath.Base(r.URL.Path)
+		if r.URL.Query().Get("expand") != "names" {
+			t.Errorf("Expected the field names to be asked for: %s", r.URL)
+		}
+		fmt.Fprintf(w, `{"id":"%s","key":"PRJ-1","names":{"summary":"Summary","customfield_10020":"Sprint"},`+
+			`"fields":{"summary":"write report","customfield_10020":%s,"description":"All the numbers",`+
+			`"assignee":{"displayName":"Anna Svensson"},"created":"2026-10-01T09:30:00.000+0200"}}`, id, sprints[id])
+	})
+	defer server.Close()
+	c := newClient(t, server.URL)
+
+	issue, err := c.GetIssue("10001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := issue.CurrentSprint(); s == nil || s.Name != "Sprint 2" || !s.Active() {
+		t.Errorf("Expected the active sprint, got %+v", issue.Sprints)
+	}
+	if issue.Fields.Description != "All the numbers" || issue.Fields.Assignee.DisplayName != "Anna Svensson" {
+		t.Errorf("Unexpected fields %+v", issue.Fields)
+	}
+	issue, err = c.GetIssue("10002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := issue.CurrentSprint(); s == nil || s.ID != 7 || s.Name != "Sprint 7" || s.Active() {
+		t.Errorf("Expected the sprint of the string, got %+v", issue.Sprints)
+	}
+	if issue, err = c.GetIssue("10003"); err != nil || issue.CurrentSprint() != nil {
+		t.Errorf("Expected no sprint, got %+v %v", issue, err)
+	}
+}
+
+func TestShowFallsBackToCachedIssue(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	issue := server.issue("10001", "PRJ-1", "TODO: write the final report", false)
+	issue.Fields.Assignee = &jira.User{DisplayName: "Anna Svensson"}
+	issue.Fields.Description = "All the numbers of Q3"
+	issue.Fields.Priority = &jira.Priority{Name: "High"}
+	issue.Fields.Labels = []string{"reports"}
+	server.comments["10001"] = []jira.Comment{{ID: "1", Body: "Numbers are in", Author: &jira.User{Name: "anna"}}}
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write the final report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := newTodo(t, server, s, withSynced, withOutbox)
+	var err error
+	if todo.Issues, err = issuecache.Open(filepath.Join(t.TempDir(), "todo.issues")); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	todo.Out = &out
+	todo.Output = "json"
+
+	show := func() cmd.TaskDetails {
+		out.Reset()
+		if err := todo.Show([]string{"1"}, 0); err != nil {
+			t.Fatal(err)
+		}
+		var d cmd.TaskDetails
+		if err := json.Unmarshal(out.Bytes(), &d); err != nil {
+			t.Fatalf("Show did not print json: %v\n%s", err, out.String())
+		}
+		return d
+	}
+	d := show()
+	if d.Issue == nil || d.Issue.Cached || d.Issue.Assignee != "Anna Svensson" || d.Issue.Status != "To Do" ||
+		d.Issue.Description != "All the numbers of Q3" || d.Issue.Priority != "High" {
+		t.Fatalf("Expected the issue fetched from Jira, got %+v", d.Issue)
+	}
+	if len(d.Thread) != 1 || d.Thread[0].Author != "anna" {
+		t.Errorf("Expected the comment of the issue, got %+v", d.Thread)
+	}
+
+	// Jira goes down, the note is queued and the cached issue is shown
+	todo.JC.BaseURL = unreachable()
+	if err := todo.Note([]string{"1"}, "Sent to Anna"); err != nil {
+		t.Fatal(err)
+	}
+	d = show()
+	if d.Issue == nil || !d.Issue.Cached || d.Issue.Assignee != "Anna Svensson" || len(d.Thread) != 2 {
+		t.Errorf("Expected the cached issue and both notes, got %+v %+v", d.Issue, d.Thread)
+	}
+	if len(d.Sync.Queued) != 1 || d.Sync.Queued[0] != "comment" {
+		t.Errorf("Expected the queued note in the sync state, got %+v", d.Sync)
+	}
+
+	todo.Output = ""
+	out.Reset()
+	if err := todo.Show([]string{"1"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	for _, want := range []string{"write the final report", "Anna Svensson", "cached, as of", "1 changes waiting for Jira (comment)",
+		"the last 1 of 2", "you, not in Jira yet"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Numbers are in") {
+		t.Errorf("Expected only the last note, got\n%s", text)
+	}
+}
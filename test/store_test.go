@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"todo/internal/config"
+	"todo/internal/store"
+)
+
+func TestStores(t *testing.T) {
+	dir := t.TempDir()
+	bolt, err := store.NewBolt(filepath.Join(dir, "todo.db"))
+	if err != nil {
+		t.Fatalf("Could not open bolt store: %v", err)
+	}
+	defer bolt.Close()
+	f, err := config.Open(filepath.Join(dir, "todo.yaml"))
+	if err != nil {
+		t.Fatalf("Could not open config file: %v", err)
+	}
+	defer f.Close()
+	stores := map[string]store.Store{
+		"yaml": store.NewYAML(f, &config.Cfg{}),
+		"bolt": bolt,
+	}
+	for name, s := range stores {
+		for _, text := range []string{"first", "second", "third"} {
+			if err := s.Add(&config.Task{Text: text}); err != nil {
+				t.Fatalf("%s: could not add task: %v", name, err)
+			}
+		}
+		if err := s.Update(&config.Task{ID: 2, Text: "second", Done: true}); err != nil {
+			t.Fatalf("%s: could not update task: %v", name, err)
+		}
+		if err := s.Delete(1); err != nil {
+			t.Fatalf("%s: could not delete task: %v", name, err)
+		}
+		if err := s.Delete(1); err == nil {
+			t.Errorf("%s: should not be able to delete missing task", name)
+		}
+		task := &config.Task{Text: "fourth"}
+		if err := s.Add(task); err != nil || task.ID != 4 {
+			t.Errorf("%s: expected new task to get ID 4, got %d (%v)", name, task.ID, err)
+		}
+		if err := s.Delete(4); err != nil {
+			t.Fatalf("%s: could not delete task: %v", name, err)
+		}
+		task = &config.Task{Text: "fifth"}
+		if err := s.Add(task); err != nil || task.ID != 5 {
+			t.Errorf("%s: IDs must not be reused, got %d (%v)", name, task.ID, err)
+		}
+		tasks, err := s.Tasks()
+		if err != nil {
+			t.Fatalf("%s: could not list tasks: %v", name, err)
+		}
+		if len(tasks) != 3 || tasks[0].Text != "second" || !tasks[0].Done || tasks[1].Text != "third" {
+			t.Errorf("%s: unexpected tasks after update and delete: %+v", name, tasks)
+		}
+	}
+}
+
+func TestMigrateToBolt(t *testing.T) {
+	dir := t.TempDir()
+	f, err := config.Open(filepath.Join(dir, "todo.yaml"))
+	if err != nil {
+		t.Fatalf("Could not open config file: %v", err)
+	}
+	defer f.Close()
+	cfg := &config.Cfg{
+		Tasks: []*config.Task{{Text: "old"}},
+		Store: config.Store{Type: "bolt"},
+	}
+	s, err := store.Open(f, cfg)
+	if err != nil {
+		t.Fatalf("Could not open store: %v", err)
+	}
+	defer s.Close()
+	if len(cfg.Tasks) != 0 {
+		t.Errorf("Tasks should be removed from the yaml config after migration")
+	}
+	tasks, err := s.Tasks()
+	if err != nil || len(tasks) != 1 || tasks[0].Text != "old" {
+		t.Errorf("Task was not migrated: %+v %v", tasks, err)
+	}
+}
+
+func TestMigrateIDs(t *testing.T) {
+	f, err := config.Open(filepath.Join(t.TempDir(), "todo.yaml"))
+	if err != nil {
+		t.Fatalf("Could not open config file: %v", err)
+	}
+	defer f.Close()
+	cfg := &config.Cfg{
+		Tasks: []*config.Task{{Text: "old"}, {ID: 7, Text: "new"}, {Text: "older"}},
+	}
+	if _, err = store.Open(f, cfg); err != nil {
+		t.Fatalf("Could not open store: %v", err)
+	}
+	for i, id := range []int{8, 7, 9} {
+		if cfg.Tasks[i].ID != id {
+			t.Errorf("Expected task '%s' to get ID %d, got %d", cfg.Tasks[i].Text, id, cfg.Tasks[i].ID)
+		}
+	}
+	saved, err := f.Read()
+	if err != nil || saved.NextID != 9 || saved.Tasks[0].ID != 8 {
+		t.Errorf("Migrated IDs were not written: %+v %v", saved, err)
+	}
+}
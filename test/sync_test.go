@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"todo/cmd"
+	"todo/internal/config"
+)
+
+func TestSyncPullsRemoteChanges(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: write the report", true)
+	server.issue("10002", "OPS-7", "TODO: review PR", false)
+	s := &flakyStore{tasks: []*config.Task{
+		{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"},
+		{ID: 2, Text: "review PR", JiraID: "10002", JiraKey: "PRJ-2"},
+		{ID: 3, Text: "offline task"},
+	}}
+	todo := newTodo(t, server, s, withSynced)
+
+	if err := todo.Sync(cmd.PreferSkip); err != nil {
+		t.Fatal(err)
+	}
+	task := s.tasks[0]
+	if task.Text != "write the report" || !task.Done || task.Completed.IsZero() {
+		t.Errorf("Changes made in Jira were not pulled: %+v", task)
+	}
+	if s.tasks[1].JiraKey != "OPS-7" {
+		t.Errorf("The key of a moved issue was not updated: %+v", s.tasks[1])
+	}
+	if len(server.updates) != 0 {
+		t.Errorf("Nothing should be pushed to Jira: %v", server.updates)
+	}
+	if state, ok := todo.Synced.Get(1); !ok || state.Text != "write the report" || !state.Done {
+		t.Errorf("Synced state was not saved: %+v", state)
+	}
+
+	// A second sync has nothing to do
+	n := len(server.requests)
+	if err := todo.Sync(cmd.PreferSkip); err != nil || len(server.requests) != n+1 {
+		t.Errorf("Second sync should only search: %v %v", err, server.requests[n:])
+	}
+}
+
+func TestSyncPushesLocalChanges(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{}
+	todo := newTodo(t, server, s, withSynced)
+	if err := todo.Add("write report", false); err != nil {
+		t.Fatal(err)
+	}
+	// Changed locally while the Jira update was lost
+	s.tasks[0].Text = "write final report"
+	s.tasks[0].Done = true
+
+	if err := todo.Sync(cmd.PreferSkip); err != nil {
+		t.Fatal(err)
+	}
+	issue := server.remote["10001"]
+	if issue.Fields.Summary != "TODO: write final report" || !issue.Done() {
+		t.Errorf("Local changes were not pushed: %+v", issue.Fields)
+	}
+	if s.tasks[0].Text != "write final report" {
+		t.Errorf("Local changes were lost: %+v", s.tasks[0])
+	}
+}
+
+func TestSyncConflicts(t *testing.T) {
+	for _, prefer := range []string{cmd.PreferSkip, cmd.PreferLocal, cmd.PreferRemote} {
+		server := newFakeJira()
+		s := &flakyStore{}
+		todo := newTodo(t, server, s, withSynced)
+		if err := todo.Add("write report", false); err != nil {
+			t.Fatal(err)
+		}
+		s.tasks[0].Text = "write local report"
+		server.remote["10001"].Fields.Summary = "TODO: write remote report"
+		// Only changed in Jira, so not a conflict
+		setStatus(server.remote["10001"], true)
+
+		if err := todo.Sync(prefer); err != nil {
+			t.Fatalf("%s: %v", prefer, err)
+		}
+		local, remote := s.tasks[0].Text, issueText(server.remote["10001"].Fields.Summary)
+		switch prefer {
+		case cmd.PreferSkip:
+			if local != "write local report" || remote != "write remote report" || s.tasks[0].Done {
+				t.Errorf("skip: conflict should be left as is: %s / %s", local, remote)
+			}
+		case cmd.PreferLocal:
+			if local != "write local report" || remote != local || !s.tasks[0].Done {
+				t.Errorf("local: expected the local text on both sides: %s / %s", local, remote)
+			}
+		case cmd.PreferRemote:
+			if local != "write remote report" || remote != local || !s.tasks[0].Done {
+				t.Errorf("remote: expected the Jira text on both sides: %s / %s", local, remote)
+			}
+		}
+		server.Close()
+	}
+}
+
+func TestSyncDeletedIssue(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{tasks: []*config.Task{
+		{ID: 1, Text: "write report", JiraID: "9001", JiraKey: "PRJ-1"},
+		{ID: 2, Text: "review PR", JiraID: "9002", JiraKey: "PRJ-2", Done: true},
+	}}
+	todo := newTodo(t, server, s, withSynced)
+
+	if err := todo.Sync(cmd.PreferSkip); err != nil || len(s.tasks) != 2 || s.tasks[0].JiraKey != "PRJ-1" {
+		t.Fatalf("skip should leave tasks of deleted issues alone: %v %+v", err, s.tasks)
+	}
+	if err := todo.Sync(cmd.PreferLocal); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.remote) != 2 || s.tasks[1].JiraKey != "PRJ-2" || s.tasks[1].JiraID != "10002" ||
+		!server.remote["10002"].Done() {
+		t.Errorf("local should create new issues: %+v %v", s.tasks[1], server.remote)
+	}
+
+	delete(server.remote, "10001")
+	if err := todo.Sync(cmd.PreferRemote); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.tasks) != 1 || s.tasks[0].ID != 2 {
+		t.Errorf("remote should delete the task of a deleted issue: %+v", s.tasks)
+	}
+}
+
+func issueText(summary string) string {
+	return strings.TrimPrefix(summary, "TODO: ")
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"jira"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"todo/cmd"
+	"todo/internal/config"
+	"todo/internal/outbox"
+	"todo/internal/store"
+)
+
+func TestTimerLogsWork(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: write report", false)
+	s := &flakyStore{tasks: []*config.Task{
+		{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"},
+		{ID: 2, Text: "call mom"},
+	}}
+	todo := newTodo(t, server, s)
+
+	if err := todo.StartTimer([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.StartTimer([]string{"1"}); err == nil {
+		t.Errorf("Expected a running timer not to be started again")
+	}
+	// Pretend the timer has run for a while
+	s.tasks[0].TimeEntries[0].Start = time.Now().Add(-95 * time.Minute)
+	if err := todo.StartTimer([]string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+	e := s.tasks[0].TimeEntries[0]
+	if e.Running() || s.tasks[1].Timer() != 0 {
+		t.Fatalf("Expected starting a timer to stop the running one: %+v %+v", s.tasks[0], s.tasks[1])
+	}
+	logs := server.worklogs["10001"]
+	if len(logs) != 1 || logs[0].TimeSpentSeconds != 95*60 || e.WorklogID != logs[0].ID {
+		t.Errorf("Expected 95 minutes logged on the issue, got %+v %+v", logs, e)
+	}
+	if started, err := time.Parse(jira.TimeFormat, logs[0].Started); err != nil || started.Unix() != e.Start.Unix() {
+		t.Errorf("Expected the worklog to start with the timer, got %s %v", logs[0].Started, err)
+	}
+
+	if err := todo.StopTimer("called"); err != nil {
+		t.Fatal(err)
+	}
+	if s.tasks[1].Timer() != -1 || s.tasks[1].TimeEntries[0].Message != "called" {
+		t.Errorf("Expected the timer to be stopped: %+v", s.tasks[1].TimeEntries)
+	}
+	if err := todo.StopTimer(""); err == nil {
+		t.Errorf("Expected an error without a running timer")
+	}
+
+	if err := todo.LogTime([]string{"1"}, 30*time.Second, "proofreading"); err != nil {
+		t.Fatal(err)
+	}
+	logs = server.worklogs["10001"]
+	if len(logs) != 2 || logs[1].TimeSpentSeconds != 60 || logs[1].Comment != "proofreading" {
+		t.Errorf("Expected at least a minute to be logged, got %+v", logs)
+	}
+
+	s.broken = true
+	if err := todo.LogTime([]string{"1"}, time.Hour, ""); err == nil {
+		t.Fatalf("Log should fail when the task can't be saved")
+	}
+	if len(server.worklogs["10001"]) != 2 {
+		t.Errorf("Expected the worklog to be deleted again, got %+v", server.worklogs["10001"])
+	}
+}
+
+func TestTimerIsStartedOnceWithBoltStore(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: write report", false)
+	bolt, err := store.NewBolt(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+	if err := bolt.Add(&config.Task{Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}); err != nil {
+		t.Fatal(err)
+	}
+	todo := newTodo(t, server, &flakyStore{})
+	todo.Store = bolt
+
+	if err := todo.StartTimer([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.StartTimer([]string{"1"}); err == nil {
+		t.Errorf("Expected a running timer not to be started again")
+	}
+	tasks, err := bolt.Tasks()
+	if err != nil || len(tasks[0].TimeEntries) != 1 || len(server.worklogs["10001"]) != 0 {
+		t.Errorf("Expected the timer to keep running, got %+v %+v", tasks[0].TimeEntries, server.worklogs)
+	}
+}
+
+func TestRejectedWorklogKeepsTime(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: write report", false)
+	server.reply["POST /rest/api/2/issue/10001/worklog"] = fakeReply{
+		http.StatusForbidden, `{"errorMessages":["You do not have the permission to log work on this issue."]}`}
+	bolt, err := store.NewBolt(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+	if err := bolt.Add(&config.Task{Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}); err != nil {
+		t.Fatal(err)
+	}
+	todo := newTodo(t, server, &flakyStore{}, withOutbox)
+	todo.Store = bolt
+
+	if err := todo.StartTimer([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.StopTimer("drafted"); err != nil {
+		t.Fatalf("Expected the stop to be saved although Jira rejected the worklog: %v", err)
+	}
+	if err := todo.LogTime([]string{"1"}, time.Hour, "reviewed"); err != nil {
+		t.Fatalf("Expected the time to be saved although Jira rejected the worklog: %v", err)
+	}
+	tasks, err := bolt.Tasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := tasks[0].TimeEntries
+	if tasks[0].Timer() >= 0 || len(entries) != 2 || entries[0].Message != "drafted" || entries[1].Message != "reviewed" {
+		t.Errorf("Expected the timer to be stopped and the time kept, got %+v", entries)
+	}
+	ops := todo.Outbox.Ops()
+	if len(ops) != 2 || len(todo.Outbox.Pending()) != 0 || ops[0].Kind != outbox.Worklog || !strings.Contains(ops[0].Error, "permission") {
+		t.Errorf("Expected the rejected worklogs to be kept in the outbox, got %+v", ops)
+	}
+}
+
+func TestWorklogsAreQueuedWhileJiraIsDown(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	server.issue("10001", "PRJ-1", "TODO: write report", false)
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := newTodo(t, server, s, withSynced, withOutbox)
+	todo.JC.BaseURL = unreachable()
+
+	if err := todo.LogTime([]string{"1"}, time.Hour, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.StartTimer([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	ops := todo.Outbox.Pending()
+	if len(ops) != 1 || ops[0].Kind != outbox.Worklog {
+		t.Fatalf("Expected the worklog to be queued, got %+v", ops)
+	}
+	todo.JC.BaseURL = server.URL
+	if err := todo.Flush(0); err != nil {
+		t.Fatal(err)
+	}
+	if logs := server.worklogs["10001"]; len(logs) != 1 || logs[0].TimeSpentSeconds != 3600 {
+		t.Errorf("Expected only the finished entry to be logged, got %+v", logs)
+	}
+	if s.tasks[0].TimeEntries[0].WorklogID == "" || s.tasks[0].Timer() != 1 {
+		t.Errorf("Unexpected time entries %+v", s.tasks[0].TimeEntries)
+	}
+}
+
+func TestReportTime(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	day := func(d, h int) time.Time { return time.Date(2018, 5, d, h, 0, 0, 0, time.Local) }
+	s := &flakyStore{tasks: []*config.Task{
+		{ID: 1, Text: "write report", Tags: []string{"docs", "q2"}, TimeEntries: []config.TimeEntry{
+			{Start: day(1, 9), End: day(1, 11)},
+			{Start: day(2, 23), End: day(3, 1)},
+		}},
+		{ID: 2, Text: "call mom", TimeEntries: []config.TimeEntry{
+			{Start: day(3, 12), End: day(3, 12).Add(30 * time.Minute)},
+			// Before the report
+			{Start: day(1, 7), End: day(1, 8)},
+		}},
+		{ID: 3, Text: "nothing done"},
+	}}
+	todo := newTodo(t, server, s)
+	var out bytes.Buffer
+	todo.Out = &out
+	todo.Output = "json"
+
+	if err := todo.ReportTime(day(1, 9), day(4, 0)); err != nil {
+		t.Fatal(err)
+	}
+	var report cmd.TimeReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Report is not json: %v\n%s", err, out.String())
+	}
+	if report.Hours != 4.5 || len(report.Tasks) != 2 || report.Tasks[0].Hours != 4 || report.Tasks[1].Hours != 0.5 {
+		t.Errorf("Unexpected hours per task %+v", report)
+	}
+	tags := map[string]float64{}
+	for _, tag := range report.Tags {
+		tags[tag.Name] = tag.Hours
+	}
+	if len(tags) != 3 || tags["docs"] != 4 || tags["q2"] != 4 || tags["(untagged)"] != 0.5 {
+		t.Errorf("Unexpected hours per tag %+v", report.Tags)
+	}
+	days := []string{}
+	for _, d := range report.Days {
+		days = append(days, fmt.Sprintf("%s=%g", d.Name, d.Hours))
+	}
+	if got := strings.Join(days, " "); got != "2018-05-01=2 2018-05-02=1 2018-05-03=1.5" {
+		t.Errorf("Expected time past midnight to count for the next day, got %s", got)
+	}
+
+	if err := todo.ReportTime(day(4, 0), day(1, 0)); err == nil {
+		t.Errorf("Expected a report ending before it begins to be refused")
+	}
+}
+
+var worklog = regexp.MustCompile(`^/rest/api/2/issue/([^/]+)/worklog(?:/([^/]+))?$`)
+
+// worklog adds and deletes the worklogs of an issue
+func (f *fakeJira) worklog(w http.ResponseWriter, r *http.Request) {
+	m := worklog.FindStringSubmatch(r.URL.Path)
+	issueID, worklogID := m[1], m[2]
+	switch r.Method {
+	case "POST":
+		var wl jira.Worklog
+		json.NewDecoder(r.Body).Decode(&wl)
+		wl.ID = fmt.Sprintf("%d", 20000+len(f.worklogs[issueID])+1)
+		f.worklogs[issueID] = append(f.worklogs[issueID], wl)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(wl)
+	case "DELETE":
+		for i, wl := range f.worklogs[issueID] {
+			if wl.ID == worklogID {
+				f.worklogs[issueID] = append(f.worklogs[issueID][:i], f.worklogs[issueID][i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
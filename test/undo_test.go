@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"todo/internal/journal"
+)
+
+func TestUndoRedo(t *testing.T) {
+	server := newFakeJira()
+	defer server.Close()
+	s := &flakyStore{}
+	todo := newTodo(t, server, s)
+	todo.Journal = journal.Open(filepath.Join(t.TempDir(), "todo.journal"))
+
+	if err := todo.Add("write report", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Del([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := todo.Undo(); err != nil {
+		t.Fatalf("Could not undo del: %v", err)
+	}
+	if len(s.tasks) != 1 || !s.tasks[0].Done || s.tasks[0].JiraKey != "PRJ-2" {
+		t.Fatalf("Undo of del should bring back the completed task with a new issue: %+v", s.tasks)
+	}
+	if !server.called("POST /rest/api/2/issue/10002/transitions") {
+		t.Errorf("Re-created issue was not closed: %v", server.requests)
+	}
+
+	if err := todo.Undo(); err != nil {
+		t.Fatalf("Could not undo complete: %v", err)
+	}
+	if s.tasks[0].Done || s.tasks[0].JiraKey != "PRJ-2" {
+		t.Errorf("Undo of complete should re-open the task and keep the new issue: %+v", s.tasks[0])
+	}
+
+	if err := todo.Undo(); err != nil {
+		t.Fatalf("Could not undo add: %v", err)
+	}
+	if len(s.tasks) != 0 || !server.called("DELETE /rest/api/2/issue/10002") {
+		t.Errorf("Undo of add should delete the task and its issue: %+v %v", s.tasks, server.requests)
+	}
+	if err := todo.Undo(); err == nil {
+		t.Errorf("There should be nothing left to undo")
+	}
+
+	if err := todo.Redo(); err != nil {
+		t.Fatalf("Could not redo add: %v", err)
+	}
+	if len(s.tasks) != 1 || s.tasks[0].ID != 1 || s.tasks[0].JiraKey != "PRJ-3" {
+		t.Errorf("Redo of add should bring back task 1 with a new issue: %+v", s.tasks)
+	}
+
+	if err := todo.Add("another", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := todo.Redo(); err == nil {
+		t.Errorf("A new change should clear the redo history")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+	"todo/internal/when"
+)
+
+func TestParseDates(t *testing.T) {
+	// A Wednesday afternoon
+	now := time.Date(2018, 5, 2, 14, 30, 0, 0, time.UTC)
+	day := func(d, h, m int) time.Time { return time.Date(2018, 5, d, h, m, 0, 0, time.UTC) }
+	tests := []struct {
+		in    string
+		want  time.Time
+		clock bool
+	}{
+		{"today", day(2, 0, 0), false},
+		{"tomorrow", day(3, 0, 0), false},
+		{"Tomorrow 9am", day(3, 9, 0), true},
+		{"yesterday", day(1, 0, 0), false},
+		{"wed", day(2, 0, 0), false},
+		{"fri 17:00", day(4, 17, 0), true},
+		{"friday 5:30pm", day(4, 17, 30), true},
+		{"mon", day(7, 0, 0), false},
+		{"next monday", day(14, 0, 0), false},
+		{"next week", day(9, 0, 0), false},
+		{"+3d", day(5, 0, 0), false},
+		{"-1w", time.Date(2018, 4, 25, 0, 0, 0, 0, time.UTC), false},
+		{"+1m", time.Date(2018, 6, 2, 0, 0, 0, 0, time.UTC), false},
+		{"+2h", day(2, 16, 30), true},
+		{"18:15", day(2, 18, 15), true},
+		{"now", now, true},
+		{"2018-06-01", time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2018-06-01 08:00", time.Date(2018, 6, 1, 8, 0, 0, 0, time.UTC), true},
+		{"2018-06-01T08:00:00Z", time.Date(2018, 6, 1, 8, 0, 0, 0, time.UTC), true},
+	}
+	for _, test := range tests {
+		got, clock, err := when.Parse(test.in, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.in, err)
+			continue
+		}
+		if !got.Equal(test.want) || clock != test.clock {
+			t.Errorf("%s: expected %v (clock %v), got %v (clock %v)", test.in, test.want, test.clock, got, clock)
+		}
+	}
+	for _, in := range []string{"", "someday", "next", "fri 25:00", "13pm", "+3x"} {
+		if _, _, err := when.Parse(in, now); err == nil {
+			t.Errorf("%s: expected an error", in)
+		}
+	}
+	due, err := when.Due("fri", now)
+	if err != nil || !due.Equal(day(4, 23, 59).Add(59*time.Second)) || !when.IsEndOfDay(due) {
+		t.Errorf("A due date without time should be the end of the day, got %v %v", due, err)
+	}
+	for in, want := range map[string]time.Time{
+		"mon":     time.Date(2018, 4, 30, 0, 0, 0, 0, time.UTC),
+		"wed":     day(2, 0, 0),
+		"fri 9am": time.Date(2018, 4, 27, 9, 0, 0, 0, time.UTC),
+		"-3d":     time.Date(2018, 4, 29, 0, 0, 0, 0, time.UTC),
+	} {
+		if since, err := when.Since(in, now); err != nil || !since.Equal(want) {
+			t.Errorf("%s: expected the last one, %v, got %v %v", in, want, since, err)
+		}
+	}
+	for in, want := range map[string]time.Time{
+		"fri":       day(5, 0, 0),
+		"today":     day(3, 0, 0),
+		"fri 17:00": day(4, 17, 0),
+	} {
+		if until, err := when.Until(in, now); err != nil || !until.Equal(want) {
+			t.Errorf("%s: expected the end of the day, %v, got %v %v", in, want, until, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"jira"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"todo/cmd"
+	"todo/internal/config"
+)
+
+// workflowStatus is a status of the workflow of workflowJira and the
+// transitions leaving it, by name
+type workflowStatus struct {
+	name, category string
+	transitions    map[string]string
+}
+
+// workflow goes To Do -> In Progress -> In Review -> Done, with no way
+// straight to Done
+var workflow = map[string]workflowStatus{
+	"1":  {"To Do", "new", map[string]string{"Start": "3"}},
+	"3":  {"In Progress", "indeterminate", map[string]string{"Review": "5", "Stop": "1"}},
+	"5":  {"In Review", "indeterminate", map[string]string{"Approve": "10", "Reject": "3"}},
+	"10": {"Done", "done", map[string]string{"Reopen": "3"}},
+}
+
+// workflowJira moves issues through workflow
+type workflowJira struct {
+	*countingServer
+	mu     sync.Mutex
+	status map[string]string
+	moves  []string
+}
+
+func newWorkflowJira(issues map[string]string) *workflowJira {
+	s := &workflowJira{status: issues}
+	s.countingServer = newCountingServer(func(w http.ResponseWriter, r *http.Request, call int) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/rest/api/2/issue/"), "/")
+		current, ok := s.status[parts[0]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		status := func(id string) map[string]interface{} {
+			return map[string]interface{}{
+				"id":             id,
+				"name":           workflow[id].name,
+				"statusCategory": map[string]string{"key": workflow[id].category},
+			}
+		}
+		switch {
+		case len(parts) == 1 && r.Method == "GET":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":     parts[0],
+				"fields": map[string]interface{}{"status": status(current)},
+			})
+		case len(parts) == 2 && r.Method == "GET":
+			var transitions []map[string]interface{}
+			for name, to := range workflow[current].transitions {
+				transitions = append(transitions, map[string]interface{}{"id": to, "name": name, "to": status(to)})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"transitions": transitions})
+		case len(parts) == 2 && r.Method == "POST":
+			body := struct {
+				Transition struct {
+					ID string `json:"id"`
+				} `json:"transition"`
+			}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			for name, to := range workflow[current].transitions {
+				if to == body.Transition.ID {
+					s.status[parts[0]] = to
+					s.moves = append(s.moves, name)
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorMessages":["Transition is not valid"]}`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	return s
+}
+
+func TestMoveIssueWalksTheWorkflow(t *testing.T) {
+	server := newWorkflowJira(map[string]string{"10001": "1"})
+	defer server.Close()
+	c := newClient(t, server.URL)
+
+	if err := c.MoveIssue("10001", jira.Target{Category: jira.StatusDone}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(server.moves, ","); got != "Start,Review,Approve" || server.status["10001"] != "10" {
+		t.Errorf("Expected the issue to be walked to Done, got %s", got)
+	}
+
+	server.moves = nil
+	if err := c.MoveIssue("10001", jira.Target{Category: jira.StatusDone}, ""); err != nil || len(server.moves) != 0 {
+		t.Errorf("Expected nothing to be done for an issue already done, got %v %v", server.moves, err)
+	}
+	if err := c.MoveIssue("10001", jira.Target{StatusID: "1", Name: "To Do"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(server.moves, ","); got != "Reopen,Stop" {
+		t.Errorf("Expected the issue to be walked back to To Do, got %s", got)
+	}
+
+	err := c.MoveIssue("10001", jira.Target{StatusID: "42", Name: "Won't Do"}, "")
+	if err == nil || !strings.Contains(err.Error(), "'Won't Do'") {
+		t.Errorf("Expected an unreachable status to be reported, got %v", err)
+	}
+}
+
+func TestCompleteMovesToStatusCategory(t *testing.T) {
+	server := newWorkflowJira(map[string]string{"10001": "1"})
+	defer server.Close()
+	s := &flakyStore{tasks: []*config.Task{{ID: 1, Text: "write report", JiraID: "10001", JiraKey: "PRJ-1"}}}
+	todo := &cmd.Todo{JC: newClient(t, server.URL), Config: &config.Cfg{}, Store: s}
+	todo.Config.Jira.Project = config.Project{DoneStatus: config.Status{Category: jira.StatusDone}}
+
+	if err := todo.Complete([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if server.status["10001"] != "10" || !s.tasks[0].Done {
+		t.Errorf("Expected the issue to be done, it is in status %s", server.status["10001"])
+	}
+	if err := todo.Oops([]string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if server.status["10001"] != "1" || s.tasks[0].Done {
+		t.Errorf("Expected the issue to be re-opened to To Do, it is in status %s", server.status["10001"])
+	}
+}